@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// parseAggregate splits an --aggregate value of the form target=glob.
+func parseAggregate(spec string) (target, pattern string, err error) {
+	target, pattern, ok := strings.Cut(spec, "=")
+	target, pattern = strings.TrimSpace(target), strings.TrimSpace(pattern)
+	if !ok || target == "" || pattern == "" {
+		return "", "", fmt.Errorf("invalid --aggregate %q (expected target=glob)", spec)
+	}
+	if !validGlob(pattern) {
+		return "", "", fmt.Errorf("invalid --aggregate pattern %q", pattern)
+	}
+	return target, pattern, nil
+}
+
+// applyAggregates adds one entry per --aggregate, dated by the newest file
+// matching its glob. An existing entry for the target is replaced. Globs
+// are matched against slash-separated paths relative to TargetDir.
+func (dh *DocHelper) applyAggregates(files []FileModTime) []FileModTime {
+	for _, spec := range dh.Aggregates {
+		target, pattern, _ := parseAggregate(spec)
+
+		var newest time.Time
+		matched := 0
+		for _, file := range files {
+			if matchGlob(pattern, filepath.ToSlash(file.Path)) {
+				matched++
+				if file.LastModified.After(newest) {
+					newest = file.LastModified
+				}
+			}
+		}
+		if matched == 0 {
+			slog.Warn("no files match --aggregate pattern", "target", target, "pattern", pattern)
+			continue
+		}
+
+		entry := FileModTime{
+			Path:         filepath.FromSlash(target),
+			LastModified: newest,
+			UnixTime:     newest.Unix(),
+		}
+		replaced := false
+		for i := range files {
+			if files[i].Path == entry.Path {
+				files[i] = entry
+				replaced = true
+			}
+		}
+		if !replaced {
+			files = append(files, entry)
+		}
+		slog.Info("Aggregated", "path", target, "matched", matched, timeAttr(newest))
+	}
+	return files
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyAggregates(t *testing.T) {
+	older, newer := time.Unix(1700000000, 0), time.Unix(1710000000, 0)
+	files := []FileModTime{
+		{Path: "content/a.md", LastModified: older},
+		{Path: "content/posts/b.md", LastModified: newer},
+		{Path: "static/c.css", LastModified: newer.Add(time.Hour)},
+		{Path: "index.html", LastModified: older},
+	}
+
+	dh := NewDocHelper(t.TempDir(), "", "document")
+	dh.Aggregates = stringList{"index.html=content/**/*.md", "feed.xml=nothing/**"}
+	got := dh.applyAggregates(files)
+
+	if len(got) != len(files) {
+		t.Fatalf("got %d entries, want %d", len(got), len(files))
+	}
+	if got[3].Path != "index.html" || !got[3].LastModified.Equal(newer) || got[3].UnixTime != newer.Unix() {
+		t.Errorf("index.html entry = %+v, want newest content time %s", got[3], newer)
+	}
+
+	if _, _, err := parseAggregate("index.html"); err == nil {
+		t.Error("aggregate without a glob accepted")
+	}
+}
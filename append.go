@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// appendCSVDocument adds files to the CSV document at outputPath for
+// --append, creating it with a header when it does not exist yet. The
+// existing header must match the columns this run writes, so runs with
+// different columns are never mixed in one document.
+func (dh *DocHelper) appendCSVDocument(files []FileModTime, outputPath string) error {
+	var buf bytes.Buffer
+	if err := dh.WriteCSV(&buf, files); err != nil {
+		return err
+	}
+	header, rows, _ := strings.Cut(buf.String(), "\n")
+
+	existing, err := readCSVHeader(outputPath)
+	if err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot read existing output: %v", err))
+	}
+	data := buf.String()
+	if existing != "" {
+		if existing != header {
+			return withExitCode(exitOutputFile, fmt.Errorf("cannot append to %s: its columns %q differ from %q (pin them with --columns)", outputPath, existing, header))
+		}
+		data = rows
+	}
+
+	f, err := os.OpenFile(outputPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+	if _, err := f.Write(dh.withLineEnding([]byte(data))); err != nil {
+		f.Close()
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+	if err := f.Close(); err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+
+	slog.Info("Appended to CSV document", "path", outputPath, "files", len(files), "new", existing == "")
+	return nil
+}
+
+// readCSVHeader returns the first line of the CSV document at path, or ""
+// when it does not exist or is empty.
+func readCSVHeader(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() {
+		return strings.TrimSuffix(scanner.Text(), "\r"), nil
+	}
+	return "", scanner.Err()
+}
+
+// validateAppend checks that every output of an --append run is an
+// uncompressed CSV document.
+func (dh *DocHelper) validateAppend() error {
+	if dh.Mode != "document" {
+		return fmt.Errorf("--append is only supported in document mode")
+	}
+	if dh.Update || dh.SplitByDir || dh.Bucket != "" || dh.NoClobber || dh.Backup {
+		return fmt.Errorf("--append cannot be combined with --update, --split-by-dir, --bucket, --no-clobber or --backup")
+	}
+	if dh.Format != "" && dh.Format != "csv" {
+		return fmt.Errorf("--append only writes CSV, not --format %s", dh.Format)
+	}
+	outputs := append([]string{dh.Output}, dh.Outputs...)
+	if dh.Output == "" {
+		outputs[0] = filepath.Base(dh.resolveOutput())
+	}
+	for _, output := range outputs {
+		if isGzipPath(output) || dh.Format == "" && documentExt(output) != ".csv" {
+			return fmt.Errorf("--append only writes uncompressed CSV documents, not %q", output)
+		}
+	}
+	return nil
+}
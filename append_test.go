@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendCSV(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "times.csv")
+	dh := NewDocHelper(dir, output, "document")
+	dh.Append = true
+	if err := dh.validateOptions(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := sampleFiles()
+	if err := dh.generateFile(files[:1], output); err != nil {
+		t.Fatal(err)
+	}
+	if err := dh.generateFile(files[1:], output); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "path,"); n != 1 {
+		t.Errorf("document has %d headers, want 1:\n%s", n, data)
+	}
+	restored, err := dh.ReadFromCSV(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, restored, files)
+
+	// A run with different columns must not be mixed in.
+	dirs := []FileModTime{{Path: "docs", LastModified: time.Unix(1710000000, 0), UnixTime: 1710000000, IsDir: true}}
+	if err := dh.generateFile(dirs, output); err == nil {
+		t.Error("appending rows with an is_dir column succeeded, want an error")
+	}
+
+	for _, bad := range []string{"times.json", "times.csv.gz"} {
+		dh := NewDocHelper(dir, bad, "document")
+		dh.Append = true
+		if err := dh.validateOptions(); err == nil {
+			t.Errorf("--append to %s passed validation", bad)
+		}
+	}
+}
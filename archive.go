@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractArchive unpacks the tar archive at path, gzip-compressed or not,
+// into dir, creating dir if needed, and returns the number of files
+// written. Entries are written through an os.Root so none can land outside
+// dir, even by way of a symlink in the archive. Files keep the times
+// recorded in the archive until a restore sets them.
+func extractArchive(path, dir string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, _ := r.(*bufio.Reader).Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return 0, err
+	}
+	defer root.Close()
+
+	count := 0
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		name := filepath.FromSlash(strings.TrimPrefix(header.Name, "./"))
+		if name == "" || name == "." {
+			continue
+		}
+		if !filepath.IsLocal(name) {
+			return count, fmt.Errorf("archive entry %s is outside the target directory", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(name, 0755); err != nil {
+				return count, err
+			}
+		case tar.TypeReg:
+			if err := root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return count, err
+			}
+			out, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm())
+			if err != nil {
+				return count, err
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return count, err
+			}
+			if err := root.Chtimes(name, header.ModTime, header.ModTime); err != nil {
+				return count, err
+			}
+			count++
+		case tar.TypeSymlink:
+			if err := root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return count, err
+			}
+			if err := root.Symlink(header.Linkname, name); err != nil {
+				return count, err
+			}
+		default:
+			slog.Debug("Skipped archive entry", "path", header.Name, "type", string(header.Typeflag))
+		}
+	}
+}
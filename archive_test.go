@@ -0,0 +1,122 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestArchive writes a gzip-compressed tar of the given headers, with
+// each regular file's content being its name.
+func writeTestArchive(t *testing.T, path string, headers ...*tar.Header) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(header.Name))
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(header.Name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreFromArchive(t *testing.T) {
+	work := t.TempDir()
+	archive := filepath.Join(work, "src.tar.gz")
+	packed := time.Unix(1600000000, 0)
+	writeTestArchive(t, archive,
+		&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "./a.md", Typeflag: tar.TypeReg, Mode: 0644, ModTime: packed},
+		&tar.Header{Name: "./docs/b.md", Typeflag: tar.TypeReg, Mode: 0644, ModTime: packed},
+		&tar.Header{Name: "./extra.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: packed},
+	)
+	input := filepath.Join(work, "times.json")
+	if err := newTestHelper(work, nil).generateJSONDocument(sampleFiles(), input); err != nil {
+		t.Fatal(err)
+	}
+
+	// The target does not exist yet; extraction creates it.
+	dir := filepath.Join(work, "out")
+	dh := NewDocHelper(dir, input, "restore")
+	dh.FromArchive = archive
+	if err := dh.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, file := range sampleFiles() {
+		info, err := os.Stat(filepath.Join(dir, file.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(file.LastModified) {
+			t.Errorf("%s mtime = %v, want %v", file.Path, info.ModTime(), file.LastModified)
+		}
+	}
+	// Files the document doesn't list keep the archive's time.
+	info, err := os.Stat(filepath.Join(dir, "extra.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(packed) {
+		t.Errorf("extra.txt mtime = %v, want the archive time %v", info.ModTime(), packed)
+	}
+}
+
+func TestExtractArchiveRejectsEscapes(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+	}{
+		{"dot-dot", []*tar.Header{
+			{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+		{"through symlink", []*tar.Header{
+			{Name: "link", Typeflag: tar.TypeSymlink, Linkname: ".."},
+			{Name: "link/evil.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			archive := filepath.Join(work, "evil.tar.gz")
+			writeTestArchive(t, archive, tt.headers...)
+
+			if _, err := extractArchive(archive, filepath.Join(work, "out")); err == nil {
+				t.Fatal("expected an error for an entry outside the target directory")
+			}
+			if _, err := os.Stat(filepath.Join(work, "evil.txt")); !os.IsNotExist(err) {
+				t.Errorf("entry was written outside the target directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestFromArchiveRequiresRestore(t *testing.T) {
+	dh := NewDocHelper(t.TempDir(), "", "document")
+	dh.FromArchive = "src.tar.gz"
+	if err := dh.validateOptions(); err == nil || !strings.Contains(err.Error(), "--from-archive") {
+		t.Errorf("validateOptions() = %v, want a --from-archive error", err)
+	}
+}
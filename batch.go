@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// batchGit answers lookups from times prefetched with one git log per
+// chunk of files, falling back to inner for paths the batch did not see.
+type batchGit struct {
+	inner gitRunner
+	times map[string]batchEntry
+}
+
+// batchEntry is the prefetched time of a path and the commit it came from.
+type batchEntry struct {
+	at     time.Time
+	commit string
+}
+
+func (b *batchGit) LastModified(rel string) (time.Time, string, error) {
+	if entry, ok := b.times[filepath.ToSlash(rel)]; ok {
+		return entry.at, entry.commit, nil
+	}
+	return b.inner.LastModified(rel)
+}
+
+// loadBatch prefetches the git times of the tracked files under the
+// repository prefix, size paths per git log call. A larger size means
+// fewer processes but more history held in memory at once. When only is
+// non-nil, just those paths are looked up.
+func (dh *DocHelper) loadBatch(size int, only map[string]bool) (*batchGit, error) {
+	g := &execGitRunner{Repo: dh.repo(), DateKind: dh.DateKind, CommitTZ: dh.CommitTZ, Range: dh.CommitRange}
+	rels, err := trackedFiles(g.Repo)
+	if err != nil {
+		return nil, err
+	}
+	if only != nil {
+		var kept []string
+		for _, rel := range rels {
+			if only[rel] {
+				kept = append(kept, rel)
+			}
+		}
+		rels = kept
+	}
+
+	times := make(map[string]batchEntry, len(rels))
+	for start := 0; start < len(rels); start += size {
+		end := min(start+size, len(rels))
+		if err := g.batchLastModified(rels[start:end], times); err != nil {
+			return nil, err
+		}
+	}
+	slog.Info("Prefetched git times", "files", len(times), "batch_size", size, "batches", (len(rels)+size-1)/size)
+	return &batchGit{inner: dh.runner(), times: times}, nil
+}
+
+// batchLastModified records in times the date of the newest commit touching
+// each of rels, walking their combined history once. Merge commits count
+// only for files that differ from every parent, as in a per-file git log.
+func (g *execGitRunner) batchLastModified(rels []string, times map[string]batchEntry) error {
+	args := []string{"log", "--format=%x00" + g.commitFormat(), "--name-only", "--diff-merges=dense-combined"}
+	if g.Range != "" {
+		args = append(args, g.Range)
+	}
+	args = append(args, "--")
+	for _, rel := range rels {
+		args = append(args, g.Repo.pathspec(rel))
+	}
+	output, err := runGit(g.Repo, args...)
+	if err != nil {
+		return err
+	}
+
+	var current batchEntry
+	for _, line := range strings.Split(output, "\n") {
+		if commit, ok := strings.CutPrefix(line, "\x00"); ok {
+			if current.at, current.commit, err = parseGitCommit(commit); err != nil {
+				return err
+			}
+			continue
+		}
+		// Unusual names are C-quoted with octal escapes, which Go reads too.
+		if unquoted, err := strconv.Unquote(line); err == nil && strings.HasPrefix(line, `"`) {
+			line = unquoted
+		}
+		if rel, ok := g.Repo.relative(line); ok && line != "" {
+			if _, seen := times[rel]; !seen {
+				times[rel] = current
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// sniffLen is how much of a file the heuristic reads, as git does.
+const sniffLen = 8000
+
+// emptyTree is the hash of git's empty tree, diffed against HEAD to list
+// every committed file.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// isBinaryFile reports whether path looks binary: a NUL byte in its first
+// sniffLen bytes, the heuristic git itself uses.
+func isBinaryFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+// gitBinaryFiles returns, for every file committed at HEAD, whether git
+// treats it as binary, honoring binary and diff attributes in
+// .gitattributes. Paths are slash-separated and relative to WorkTree.
+func gitBinaryFiles(repo gitRepo) (map[string]bool, error) {
+	output, err := runGit(repo, repo.scope("diff", "--numstat", "-z", "--no-renames", emptyTree, "HEAD")...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot detect binary files: %v", err)
+	}
+
+	// Each entry is "added\tdeleted\tpath", with "-" counts for binaries.
+	binary := make(map[string]bool)
+	for _, entry := range strings.Split(output, "\x00") {
+		fields := strings.SplitN(entry, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if rel, ok := repo.relative(fields[2]); ok {
+			binary[rel] = fields[0] == "-"
+		}
+	}
+	return binary, nil
+}
+
+// binaryChecker returns the check --text-only applies to each scanned
+// file, given its full path and slash-separated path relative to
+// TargetDir. With BinaryDetect "git", files git does not know at HEAD fall
+// back to the heuristic.
+func (dh *DocHelper) binaryChecker() (func(path, rel string) bool, error) {
+	var known map[string]bool
+	if dh.BinaryDetect == "git" {
+		var err error
+		if known, err = gitBinaryFiles(dh.repo()); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(path, rel string) bool {
+		if binary, ok := known[rel]; ok {
+			return binary
+		}
+		binary, err := isBinaryFile(path)
+		if err != nil {
+			slog.Warn("cannot check for binary content", "path", rel, "error", err)
+		}
+		return binary
+	}, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// checkBounds validates document times for --check-bounds before a restore.
+// Times later than now or earlier than the repository's first commit are
+// rejected, each logged, or with BoundsAction "clamp" moved to the nearest
+// bound.
+func (dh *DocHelper) checkBounds(files []FileModTime) ([]FileModTime, error) {
+	if err := dh.checkRepo(); err != nil {
+		return nil, err
+	}
+	first, err := firstCommitTime(dh.repo())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	outside := 0
+	for i, file := range files {
+		bound := file.LastModified
+		switch {
+		case file.LastModified.After(now):
+			bound = now
+		case file.LastModified.Before(first):
+			bound = first
+		default:
+			continue
+		}
+
+		outside++
+		if dh.BoundsAction == "clamp" {
+			slog.Info("Clamped", "path", file.Path, timeAttr(file.LastModified), "to", bound)
+			files[i].LastModified = bound
+			files[i].UnixTime = bound.Unix()
+			continue
+		}
+		slog.Error("time outside the repository's history", "path", file.Path, timeAttr(file.LastModified))
+	}
+
+	if outside > 0 && dh.BoundsAction != "clamp" {
+		return nil, fmt.Errorf("%d entries are dated before the first commit (%s) or in the future (--check-bounds)",
+			outside, first.Format(time.RFC3339))
+	}
+	return files, nil
+}
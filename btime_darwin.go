@@ -0,0 +1,18 @@
+//go:build darwin
+
+package main
+
+import (
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// setBirthTime sets the creation time of path with setattrlist.
+func setBirthTime(path string, t time.Time) error {
+	attrs := unix.Attrlist{Bitmapcount: unix.ATTR_BIT_MAP_COUNT, Commonattr: unix.ATTR_CMN_CRTIME}
+	ts := unix.NsecToTimespec(t.UnixNano())
+	buf := (*[unsafe.Sizeof(ts)]byte)(unsafe.Pointer(&ts))[:]
+	return unix.Setattrlist(path, &attrs, buf, 0)
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !windows
+
+package main
+
+import "time"
+
+// setBirthTime reports that creation times cannot be set; Linux has no
+// system call for it.
+func setBirthTime(path string, t time.Time) error {
+	return errBirthTimeUnsupported
+}
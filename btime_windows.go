@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"syscall"
+	"time"
+)
+
+// setBirthTime sets the creation time of path with SetFileTime.
+func setBirthTime(path string, t time.Time) error {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	handle, err := syscall.CreateFile(name, syscall.FILE_WRITE_ATTRIBUTES, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(handle)
+
+	created := syscall.NsecToFiletime(t.UnixNano())
+	return syscall.SetFileTime(handle, &created, nil, nil)
+}
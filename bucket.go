@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeBucket is the number of files last modified in one period.
+type timeBucket struct {
+	Period string   `json:"period"`
+	Count  int      `json:"count"`
+	Files  []string `json:"files,omitempty"`
+}
+
+// bucketDocument is the JSON layout written with --bucket.
+type bucketDocument struct {
+	Bucket  string       `json:"bucket"`
+	Buckets []timeBucket `json:"buckets"`
+}
+
+// bucketPeriod names the period of kind containing t: an ISO week such as
+// 2024-W03, a month such as 2024-01, or a quarter such as 2024-Q1.
+func bucketPeriod(t time.Time, kind string) string {
+	switch kind {
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+	}
+	return t.Format("2006-01")
+}
+
+// bucketFiles counts files per period of kind, newest period first. File
+// lists are kept when withFiles is set.
+func bucketFiles(files []FileModTime, kind string, withFiles bool) []timeBucket {
+	index := make(map[string]int)
+	var buckets []timeBucket
+	for _, file := range files {
+		period := bucketPeriod(file.LastModified, kind)
+		i, ok := index[period]
+		if !ok {
+			i = len(buckets)
+			index[period] = i
+			buckets = append(buckets, timeBucket{Period: period})
+		}
+		buckets[i].Count++
+		if withFiles {
+			buckets[i].Files = append(buckets[i].Files, file.Path)
+		}
+	}
+	// Periods of one kind sort chronologically as strings.
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Period > buckets[j].Period })
+	return buckets
+}
+
+// generateBucketDocument writes per-period file counts for --bucket to
+// outputPath, as JSON or CSV by its extension.
+func (dh *DocHelper) generateBucketDocument(files []FileModTime, outputPath string) error {
+	buckets := bucketFiles(files, dh.Bucket, dh.BucketFiles)
+
+	var data []byte
+	switch documentExt(outputPath) {
+	case ".csv":
+		var b bytes.Buffer
+		writer := csv.NewWriter(&b)
+		header := []string{"period", "count"}
+		if dh.BucketFiles {
+			header = append(header, "files")
+		}
+		writer.Write(header)
+		for _, bucket := range buckets {
+			row := []string{bucket.Period, strconv.Itoa(bucket.Count)}
+			if dh.BucketFiles {
+				row = append(row, strings.Join(bucket.Files, ";"))
+			}
+			writer.Write(row)
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("cannot serialize CSV: %v", err)
+		}
+		data = b.Bytes()
+	case ".json":
+		var err error
+		doc := bucketDocument{Bucket: dh.Bucket, Buckets: buckets}
+		if dh.JSONCompact {
+			data, err = json.Marshal(doc)
+		} else {
+			data, err = json.MarshalIndent(doc, "", "  ")
+		}
+		if err != nil {
+			return fmt.Errorf("cannot serialize JSON: %v", err)
+		}
+	default:
+		return fmt.Errorf("--bucket writes JSON or CSV, not %s", outputPath)
+	}
+
+	if err := dh.writeDocument(outputPath, data); err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+	slog.Info("Generated activity document", "path", outputPath, "bucket", dh.Bucket, "periods", len(buckets), "files", len(files))
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBucketPeriod(t *testing.T) {
+	at := time.Date(2024, time.January, 17, 12, 0, 0, 0, time.UTC)
+	for kind, want := range map[string]string{
+		"week":    "2024-W03",
+		"month":   "2024-01",
+		"quarter": "2024-Q1",
+	} {
+		if got := bucketPeriod(at, kind); got != want {
+			t.Errorf("bucketPeriod(%s) = %s, want %s", kind, got, want)
+		}
+	}
+}
+
+func TestBucketDocument(t *testing.T) {
+	dir := t.TempDir()
+	jan := time.Date(2024, time.January, 17, 12, 0, 0, 0, time.UTC)
+	may := time.Date(2024, time.May, 2, 12, 0, 0, 0, time.UTC)
+	files := []FileModTime{
+		{Path: "b.md", LastModified: may},
+		{Path: "a.md", LastModified: jan},
+		{Path: "c.md", LastModified: jan},
+	}
+
+	dh := NewDocHelper(dir, "", "document")
+	dh.Bucket = "quarter"
+	dh.BucketFiles = true
+	output := filepath.Join(dir, "activity.json")
+	if err := dh.generateFile(files, output); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bucketDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Bucket != "quarter" || len(doc.Buckets) != 2 {
+		t.Fatalf("document = %+v, want two quarters", doc)
+	}
+	if b := doc.Buckets[0]; b.Period != "2024-Q2" || b.Count != 1 {
+		t.Errorf("first bucket = %+v, want 2024-Q2 with one file", b)
+	}
+	if b := doc.Buckets[1]; b.Period != "2024-Q1" || b.Count != 2 || len(b.Files) != 2 {
+		t.Errorf("second bucket = %+v, want 2024-Q1 with two files", b)
+	}
+
+	dh.BucketFiles = false
+	output = filepath.Join(dir, "activity.csv")
+	if err := dh.generateFile(files, output); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "period,count\n2024-Q2,1\n2024-Q1,2\n"; string(data) != want {
+		t.Errorf("CSV = %q, want %q", data, want)
+	}
+
+	if err := dh.generateFile(files, filepath.Join(dir, "activity.md")); err == nil {
+		t.Error("Markdown output with --bucket succeeded, want an error")
+	}
+}
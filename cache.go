@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheEntry records the last-modified time git reported for a path while
+// its blob hash was Blob, and the commit the time came from.
+type cacheEntry struct {
+	Blob     string `json:"blob"`
+	UnixTime int64  `json:"unix_time"`
+	Commit   string `json:"commit"`
+}
+
+// gitCache wraps a gitRunner with a persistent cache keyed by path and git
+// blob hash, so unchanged files skip the git log call on later runs.
+// Options records the lookup options the times were found with.
+type gitCache struct {
+	path    string
+	inner   gitRunner
+	blobs   map[string]string
+	Options string                `json:"options"`
+	Entries map[string]cacheEntry `json:"entries"`
+	dirty   bool
+}
+
+// loadGitCache reads the cache at path, if any, and pairs it with the
+// current blob hashes from the index of repo. A cache written with other
+// lookup options than options starts over empty.
+func loadGitCache(path, options string, repo gitRepo, inner gitRunner) (*gitCache, error) {
+	blobs, err := indexBlobs(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &gitCache{path: path, inner: inner, blobs: blobs, Options: options, Entries: make(map[string]cacheEntry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cache: %v", err)
+	}
+	if err := json.Unmarshal(data, cache); err != nil {
+		slog.Warn("ignoring unreadable cache", "path", path, "error", err)
+		cache.Entries = make(map[string]cacheEntry)
+	}
+	if cache.Options != options {
+		slog.Info("Ignoring cache built with other lookup options", "path", path, "cached", cache.Options, "options", options)
+		cache.Options = options
+		cache.Entries = make(map[string]cacheEntry)
+		cache.dirty = true
+	}
+	return cache, nil
+}
+
+// LastModified answers from the cache when the path's blob is unchanged.
+// Entries from caches written before commits were recorded are looked up
+// again.
+func (c *gitCache) LastModified(rel string) (time.Time, string, error) {
+	key := filepath.ToSlash(rel)
+	blob, tracked := c.blobs[key]
+	if entry, ok := c.Entries[key]; ok && tracked && entry.Blob == blob && entry.Commit != "" {
+		return time.Unix(entry.UnixTime, 0), entry.Commit, nil
+	}
+
+	lastModified, commit, err := c.inner.LastModified(rel)
+	if err != nil || lastModified.IsZero() || !tracked {
+		return lastModified, commit, err
+	}
+
+	c.Entries[key] = cacheEntry{Blob: blob, UnixTime: lastModified.Unix(), Commit: commit}
+	c.dirty = true
+	return lastModified, commit, nil
+}
+
+// save writes the cache back when it changed, dropping entries for paths
+// git no longer tracks.
+func (c *gitCache) save() error {
+	for key := range c.Entries {
+		if _, ok := c.blobs[key]; !ok {
+			delete(c.Entries, key)
+			c.dirty = true
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0644)
+}
+
+// indexBlobs maps each path in the git index to its blob hash.
+func indexBlobs(repo gitRepo) (map[string]string, error) {
+	output, err := runGit(repo, repo.scope("ls-files", "-s", "-z", "--full-name")...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list git blobs: %v", err)
+	}
+
+	blobs := make(map[string]string)
+	for _, record := range strings.Split(output, "\x00") {
+		// <mode> <blob> <stage>\t<path>
+		meta, name, ok := strings.Cut(record, "\t")
+		if !ok {
+			continue
+		}
+		path, ok := repo.relative(name)
+		if !ok {
+			continue
+		}
+		if fields := strings.Fields(meta); len(fields) == 3 {
+			blobs[path] = fields[1]
+		}
+	}
+	return blobs, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// countingGit counts lookups and answers them with a fixed time.
+type countingGit struct {
+	calls int
+	at    time.Time
+}
+
+func (c *countingGit) LastModified(rel string) (time.Time, string, error) {
+	c.calls++
+	return c.at, "c0ffee", nil
+}
+
+func TestGitCache(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md")
+
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	first := &countingGit{at: time.Unix(1700000000, 0)}
+	dh := NewDocHelper(dir, "", "document")
+	dh.CachePath = cachePath
+	dh.git = first
+
+	if _, err := dh.ScanDirectory(); err != nil {
+		t.Fatal(err)
+	}
+	if first.calls != 2 {
+		t.Fatalf("first scan: %d lookups, want 2", first.calls)
+	}
+
+	second := &countingGit{at: time.Unix(1800000000, 0)}
+	dh.git = second
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.calls != 0 {
+		t.Errorf("second scan: %d lookups, want 0", second.calls)
+	}
+	for _, f := range files {
+		if f.UnixTime != 1700000000 {
+			t.Errorf("%s: got cached time %d, want 1700000000", f.Path, f.UnixTime)
+		}
+	}
+
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "b.md")
+	if _, err := dh.ScanDirectory(); err != nil {
+		t.Fatal(err)
+	}
+	if second.calls != 1 {
+		t.Errorf("after changing b.md: %d lookups, want 1", second.calls)
+	}
+}
+
+func TestGitCacheLookupOptions(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+
+	cachePath := filepath.Join(t.TempDir(), "cache.json")
+	dh := NewDocHelper(dir, "", "document")
+	dh.CachePath = cachePath
+	dh.git = &countingGit{at: time.Unix(1700000000, 0)}
+	if _, err := dh.ScanDirectory(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		set  func(dh *DocHelper)
+	}{
+		{"date-kind", func(dh *DocHelper) { dh.DateKind = "author" }},
+		{"tagged-only", func(dh *DocHelper) { dh.TaggedOnly = true }},
+		{"from-trailer", func(dh *DocHelper) { dh.FromTrailer = "Published-Date" }},
+		{"skip-bulk-commits", func(dh *DocHelper) { dh.SkipBulk = 100 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewDocHelper(dir, "", "document")
+			h.CachePath = cachePath
+			tt.set(h)
+			git := &countingGit{at: time.Unix(1800000000, 0)}
+			h.git = git
+
+			files, err := h.ScanDirectory()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if git.calls != 1 || len(files) != 1 || files[0].UnixTime != 1800000000 {
+				t.Errorf("%d lookups, files %+v; want a fresh lookup instead of the cached time", git.calls, files)
+			}
+		})
+	}
+}
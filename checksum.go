@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// fileDigest returns the hex SHA-256 of the file's content.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// verifyChecksums drops records whose file content no longer matches the
+// recorded checksum, for --verify-checksum, so stale times are not stamped
+// onto changed files. Records without a checksum are kept.
+func (dh *DocHelper) verifyChecksums(files []FileModTime) []FileModTime {
+	var kept []FileModTime
+	unchecked := 0
+	for _, file := range files {
+		if file.Checksum == "" || file.IsDir {
+			unchecked++
+			kept = append(kept, file)
+			continue
+		}
+		digest, err := fileDigest(filepath.Join(dh.TargetDir, file.Path))
+		if err == nil && digest != file.Checksum {
+			slog.Warn("Skipped file whose content changed since the document was generated", "path", file.Path)
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	if unchecked > 0 {
+		slog.Warn("records without a checksum were not verified", "count", unchecked)
+	}
+	if skipped := len(files) - len(kept); skipped > 0 {
+		slog.Info("Checksum mismatches skipped", "count", skipped)
+	}
+	return kept
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvFields lists the FileModTime fields a CSV document can carry, in the
+// default column order.
+var csvFields = []string{"path", "last_modified", "unix_time", "is_dir", "missing", "mode", "checksum", "source"}
+
+func isCSVField(name string) bool {
+	for _, field := range csvFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseColumns parses a comma-separated --columns value.
+func parseColumns(value string) ([]string, error) {
+	var columns []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !isCSVField(name) {
+			return nil, fmt.Errorf("unknown column %q (supported: %s)", name, strings.Join(csvFields, ", "))
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// parseHeaderNames parses a comma-separated list of field=header pairs.
+func parseHeaderNames(value string) (map[string]string, error) {
+	names := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		field, header, ok := strings.Cut(pair, "=")
+		field, header = strings.TrimSpace(field), strings.TrimSpace(header)
+		if !ok || header == "" {
+			return nil, fmt.Errorf("invalid header name %q (expected field=header)", pair)
+		}
+		if !isCSVField(field) {
+			return nil, fmt.Errorf("unknown column %q (supported: %s)", field, strings.Join(csvFields, ", "))
+		}
+		names[field] = header
+	}
+	return names, nil
+}
+
+// csvColumns returns the fields to write for files: the configured
+// --columns, or the standard columns plus any optional ones in use.
+func (dh *DocHelper) csvColumns(files []FileModTime) []string {
+	if len(dh.Columns) > 0 {
+		return dh.Columns
+	}
+
+	columns := []string{"path", "last_modified", "unix_time"}
+	if hasDirs(files) {
+		columns = append(columns, "is_dir")
+	}
+	if hasMissing(files) {
+		columns = append(columns, "missing")
+	}
+	if hasMode(files) {
+		columns = append(columns, "mode")
+	}
+	if hasChecksum(files) {
+		columns = append(columns, "checksum")
+	}
+	if hasSource(files) {
+		columns = append(columns, "source")
+	}
+	return columns
+}
+
+// csvHeader returns the header written for field.
+func (dh *DocHelper) csvHeader(field string) string {
+	if header, ok := dh.HeaderNames[field]; ok {
+		return header
+	}
+	return field
+}
+
+// csvField maps a header read from a CSV document back to its field name.
+func (dh *DocHelper) csvField(header string) string {
+	for field, name := range dh.HeaderNames {
+		if name == header {
+			return field
+		}
+	}
+	return header
+}
+
+// csvValue formats field of file as a CSV cell.
+func csvValue(file FileModTime, field string) string {
+	switch field {
+	case "path":
+		return file.Path
+	case "last_modified":
+		// Written in UTC, as the layout has no offset and is read back as UTC.
+		return file.LastModified.UTC().Format("2006-01-02 15:04:05")
+	case "unix_time":
+		return strconv.FormatInt(file.UnixTime, 10)
+	case "is_dir":
+		return strconv.FormatBool(file.IsDir)
+	case "missing":
+		return strconv.FormatBool(file.Missing)
+	case "mode":
+		return fmt.Sprintf("%04o", uint32(file.Mode))
+	case "checksum":
+		return file.Checksum
+	case "source":
+		return file.Source
+	}
+	return ""
+}
+
+// parseCSVTime parses a last_modified cell as written by this tool or as
+// RFC 3339.
+func parseCSVTime(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, value)
+	}
+	return t, err
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// completionModes lists the modes offered by shell completion.
+var completionModes = []string{"adjust", "document", "restore", "watch", "doctor", "prune", "xattr"}
+
+// completionShells lists the shells writeCompletion supports.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionFlag is one option as seen by shell completion.
+type completionFlag struct {
+	name, usage string
+	takesValue  bool
+}
+
+// completionFlags returns the options registered on fs, sorted by name.
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+		flags = append(flags, completionFlag{
+			name:       f.Name,
+			usage:      f.Usage,
+			takesValue: !ok || !boolFlag.IsBoolFlag(),
+		})
+	})
+	sort.Slice(flags, func(i, j int) bool { return flags[i].name < flags[j].name })
+	return flags
+}
+
+// writeCompletion writes a completion script for shell covering every flag
+// registered on fs, the modes, and file names for positional arguments.
+func writeCompletion(w io.Writer, fs *flag.FlagSet, shell string) error {
+	flags := completionFlags(fs)
+	var b strings.Builder
+
+	switch shell {
+	case "bash":
+		var names, valued []string
+		for _, f := range flags {
+			names = append(names, "--"+f.name)
+			if f.takesValue {
+				valued = append(valued, "--"+f.name)
+			}
+		}
+		b.WriteString("_dochelper() {\n")
+		b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+		b.WriteString("    case \"$prev\" in\n")
+		fmt.Fprintf(&b, "        %s)\n", strings.Join(valued, "|"))
+		b.WriteString("            COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+		b.WriteString("            return ;;\n")
+		b.WriteString("    esac\n")
+		b.WriteString("    if [[ \"$cur\" == -* ]]; then\n")
+		fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(names, " "))
+		b.WriteString("    else\n")
+		fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\") $(compgen -f -- \"$cur\"))\n", strings.Join(completionModes, " "))
+		b.WriteString("    fi\n")
+		b.WriteString("}\n")
+		b.WriteString("complete -o filenames -F _dochelper dochelper\n")
+	case "zsh":
+		escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`)
+		b.WriteString("#compdef dochelper\n\n")
+		b.WriteString("_arguments \\\n")
+		for _, f := range flags {
+			if f.takesValue {
+				fmt.Fprintf(&b, "  '--%s=[%s]:value:_files' \\\n", f.name, escape.Replace(f.usage))
+			} else {
+				fmt.Fprintf(&b, "  '--%s[%s]' \\\n", f.name, escape.Replace(f.usage))
+			}
+		}
+		fmt.Fprintf(&b, "  '*:argument:_alternative \"modes:mode:(%s)\" \"files:file:_files\"'\n", strings.Join(completionModes, " "))
+	case "fish":
+		escape := strings.NewReplacer(`\`, `\\`, "'", `\'`)
+		for _, f := range flags {
+			required := ""
+			if f.takesValue {
+				required = " -r"
+			}
+			fmt.Fprintf(&b, "complete -c dochelper -l %s%s -d '%s'\n", f.name, required, escape.Replace(f.usage))
+		}
+		fmt.Fprintf(&b, "complete -c dochelper -a '%s'\n", strings.Join(completionModes, " "))
+	case "powershell":
+		var items []string
+		for _, f := range flags {
+			items = append(items, "'--"+f.name+"'")
+		}
+		for _, mode := range completionModes {
+			items = append(items, "'"+mode+"'")
+		}
+		b.WriteString("Register-ArgumentCompleter -Native -CommandName dochelper -ScriptBlock {\n")
+		b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n")
+		fmt.Fprintf(&b, "    @(%s) |\n", strings.Join(items, ", "))
+		b.WriteString("        Where-Object { $_ -like \"$wordToComplete*\" } |\n")
+		b.WriteString("        ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_) }\n")
+		b.WriteString("}\n")
+	default:
+		return fmt.Errorf("unsupported shell: %s (supported: %s)", shell, strings.Join(completionShells, ", "))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteCompletion(t *testing.T) {
+	fs := newFlagSet(NewDocHelper("", "", ""))
+
+	for _, shell := range completionShells {
+		var buf bytes.Buffer
+		if err := writeCompletion(&buf, fs, shell); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		script := buf.String()
+		for _, want := range []string{"--no-git", "--batch-size", "document"} {
+			if shell == "fish" {
+				want = strings.TrimPrefix(want, "--")
+			}
+			if !strings.Contains(script, want) {
+				t.Errorf("%s script lacks %q", shell, want)
+			}
+		}
+	}
+
+	if err := writeCompletion(&bytes.Buffer{}, fs, "tcsh"); err == nil {
+		t.Error("unsupported shell accepted")
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+)
+
+// funcValue is a flag.Value like the one flag.Func registers, but it
+// remembers the last value given so --print-config can show it.
+type funcValue struct {
+	set   func(string) error
+	value string
+}
+
+func (v *funcValue) String() string { return v.value }
+
+func (v *funcValue) Set(value string) error {
+	v.value = value
+	return v.set(value)
+}
+
+// funcFlag registers a flag parsed by set, like fs.Func.
+func funcFlag(fs *flag.FlagSet, name, usage string, set func(string) error) {
+	fs.Var(&funcValue{set: set}, name, usage)
+}
+
+// setFlags returns the names of the flags set on fs so far.
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// configValue is one resolved option and where its value came from: flag,
+// env or default, or argument for a mode given on the command line.
+type configValue struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// writeConfig writes the resolved configuration of dh as JSON for
+// --print-config. fromFlags names the flags given on the command line;
+// any other flag that is set came from the environment.
+func writeConfig(w io.Writer, fs *flag.FlagSet, fromFlags map[string]bool, dh *DocHelper, modeSource string) error {
+	set := setFlags(fs)
+	options := make(map[string]configValue)
+	fs.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		if fromFlags[f.Name] {
+			source = "flag"
+		} else if set[f.Name] {
+			source = "env"
+		}
+		options[f.Name] = configValue{Value: f.Value.String(), Source: source}
+	})
+
+	data, err := json.MarshalIndent(struct {
+		Mode    configValue            `json:"mode"`
+		Dirs    []string               `json:"dirs"`
+		Output  string                 `json:"output,omitempty"`
+		Options map[string]configValue `json:"options"`
+	}{configValue{dh.Mode, modeSource}, dh.Dirs, dh.Output, options}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
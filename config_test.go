@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteConfig(t *testing.T) {
+	env := map[string]string{"DOCHELPER_LOG_LEVEL": "debug", "DOCHELPER_MAX_AGE": "30d"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	dh := NewDocHelper("", "", "")
+	fs := newFlagSet(dh)
+	if _, err := parseArgs(fs, []string{"--exclude", "vendor/**", "--columns", "path,unix_time", "--max-age", "90d"}); err != nil {
+		t.Fatal(err)
+	}
+	fromFlags := setFlags(fs)
+	if err := applyEnv(fs, lookup); err != nil {
+		t.Fatal(err)
+	}
+	dh.Mode = "document"
+	dh.Dirs = stringList{"/src"}
+
+	var buf bytes.Buffer
+	if err := writeConfig(&buf, fs, fromFlags, dh, "argument"); err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Mode    configValue            `json:"mode"`
+		Options map[string]configValue `json:"options"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+
+	if got.Mode != (configValue{"document", "argument"}) {
+		t.Errorf("mode = %+v", got.Mode)
+	}
+	want := map[string]configValue{
+		"exclude":   {"vendor/**", "flag"},
+		"columns":   {"path,unix_time", "flag"},
+		"max-age":   {"90d", "flag"},
+		"log-level": {"debug", "env"},
+		"workers":   {"1", "default"},
+	}
+	for name, value := range want {
+		if got.Options[name] != value {
+			t.Errorf("%s = %+v, want %+v", name, got.Options[name], value)
+		}
+	}
+}
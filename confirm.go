@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmAdjust asks on in whether count files may be changed, for
+// --confirm. With Yes it agrees without asking; without a terminal it
+// refuses, since nobody could answer.
+func (dh *DocHelper) confirmAdjust(in io.Reader, interactive bool, count int) error {
+	if dh.Yes {
+		return nil
+	}
+	if !interactive {
+		return fmt.Errorf("--confirm needs a terminal to ask on; pass --yes to proceed without asking")
+	}
+
+	fmt.Printf("About to change the times of %d files in %s. Continue? [y/N] ", count, dh.TargetDir)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("aborted, no files were changed")
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return fmt.Errorf("aborted, no files were changed")
+}
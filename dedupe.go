@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+)
+
+// dedupeByContent gives files with identical content the newest time found
+// among them, so mirrored copies such as localized assets stay consistent.
+// Directory and missing-file entries are left alone, as are files that
+// cannot be read. Each group of two or more is logged at debug level.
+func (dh *DocHelper) dedupeByContent(files []FileModTime) []FileModTime {
+	groups := make(map[string][]int)
+	var digests []string
+	for i, file := range files {
+		if file.IsDir || file.Missing {
+			continue
+		}
+		digest, err := fileDigest(filepath.Join(dh.TargetDir, file.Path))
+		if err != nil {
+			slog.Warn("cannot hash file, leaving its time as is", "path", file.Path, "error", err)
+			continue
+		}
+		if _, ok := groups[digest]; !ok {
+			digests = append(digests, digest)
+		}
+		groups[digest] = append(groups[digest], i)
+	}
+
+	merged := 0
+	for _, digest := range digests {
+		group := groups[digest]
+		if len(group) < 2 {
+			continue
+		}
+
+		newest := files[group[0]].LastModified
+		paths := make([]string, 0, len(group))
+		for _, i := range group {
+			if files[i].LastModified.After(newest) {
+				newest = files[i].LastModified
+			}
+			paths = append(paths, files[i].Path)
+		}
+		for _, i := range group {
+			files[i].LastModified = newest
+			files[i].UnixTime = newest.Unix()
+		}
+
+		sort.Strings(paths)
+		slog.Debug("Identical content", "digest", digest[:12], "paths", fmt.Sprint(paths), timeAttr(newest))
+		merged++
+	}
+	if merged > 0 {
+		slog.Info("Aligned times of identical files", "groups", merged)
+	}
+	return files
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDedupeByContent(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"en/logo.svg": "<svg/>",
+		"fr/logo.svg": "<svg/>",
+		"en/index.md": "hello",
+		"fr/index.md": "bonjour",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	older, newer := time.Unix(1700000000, 0), time.Unix(1710000000, 0)
+	files := []FileModTime{
+		{Path: filepath.FromSlash("en/logo.svg"), LastModified: older, UnixTime: older.Unix()},
+		{Path: filepath.FromSlash("fr/logo.svg"), LastModified: newer, UnixTime: newer.Unix()},
+		{Path: filepath.FromSlash("en/index.md"), LastModified: older, UnixTime: older.Unix()},
+		{Path: filepath.FromSlash("fr/index.md"), LastModified: newer, UnixTime: newer.Unix()},
+	}
+
+	dh := NewDocHelper(dir, "", "adjust")
+	got := dh.dedupeByContent(files)
+
+	if !got[0].LastModified.Equal(newer) || got[0].UnixTime != newer.Unix() {
+		t.Errorf("en/logo.svg = %+v, want the newer copy's time", got[0])
+	}
+	if !got[1].LastModified.Equal(newer) {
+		t.Errorf("fr/logo.svg = %+v, want its own time", got[1])
+	}
+	if !got[2].LastModified.Equal(older) {
+		t.Errorf("en/index.md = %+v, want unchanged", got[2])
+	}
+}
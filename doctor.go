@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Doctor checks that the environment can support the other modes and
+// prints a pass/fail checklist. It returns an error when a critical check
+// fails.
+func (dh *DocHelper) Doctor() error {
+	failed := 0
+	check := func(ok, critical bool, format string, args ...any) {
+		status := "PASS"
+		if !ok {
+			status = "WARN"
+			if critical {
+				status = "FAIL"
+				failed++
+			}
+		}
+		fmt.Printf("[%s] %s\n", status, fmt.Sprintf(format, args...))
+	}
+
+	fmt.Printf("Checking environment for %s\n\n", dh.TargetDir)
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		check(false, true, "git executable not found in PATH")
+		return dh.doctorResult(failed)
+	}
+	gitVersion, err := runGit(dh.repo(), "--version")
+	check(err == nil, true, "git found at %s (%s)", gitPath, strings.TrimSpace(gitVersion))
+
+	if err := dh.checkRepo(); err != nil {
+		check(false, true, "%v", err)
+		return dh.doctorResult(failed)
+	}
+	check(true, true, "target directory is a git repository")
+
+	bare, _ := runGit(dh.repo(), "rev-parse", "--is-bare-repository")
+	check(strings.TrimSpace(bare) != "true", true, "repository has a working tree (not bare)")
+
+	shallow, _ := runGit(dh.repo(), "rev-parse", "--is-shallow-repository")
+	if strings.TrimSpace(shallow) == "true" {
+		check(false, false, "repository is a shallow clone, times of files last changed before the cut-off will be wrong (run git fetch --unshallow)")
+	} else {
+		check(true, false, "repository has full history (not shallow)")
+	}
+
+	_, err = headCommit(dh.repo())
+	check(err == nil, false, "repository has at least one commit")
+
+	tracked, err := trackedFiles(dh.repo())
+	if err != nil {
+		check(false, true, "%v", err)
+	} else {
+		check(len(tracked) > 0, false, "git tracks %d files", len(tracked))
+	}
+
+	return dh.doctorResult(failed)
+}
+
+func (dh *DocHelper) doctorResult(failed int) error {
+	fmt.Println()
+	if failed > 0 {
+		return fmt.Errorf("%d critical checks failed", failed)
+	}
+	fmt.Println("All critical checks passed")
+	return nil
+}
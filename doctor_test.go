@@ -0,0 +1,16 @@
+package main
+
+import "testing"
+
+func TestDoctor(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+
+	if err := NewDocHelper(dir, "", "doctor").Doctor(); err != nil {
+		t.Errorf("healthy repository: %v", err)
+	}
+
+	if err := NewDocHelper(t.TempDir(), "", "doctor").Doctor(); err == nil {
+		t.Error("expected a failure for a directory that is not a repository")
+	}
+}
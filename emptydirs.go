@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// emptyDirEntries returns a directory entry, dated by the latest commit,
+// for each directory below TargetDir holding no file at any depth, such as
+// one whose content was removed. Untracked directories holding files, such
+// as build output, git-ignored directories, nested repositories and
+// submodules are not entered.
+func (dh *DocHelper) emptyDirEntries() ([]FileModTime, error) {
+	tracked, err := trackedFiles(dh.repo())
+	if err != nil {
+		return nil, err
+	}
+	ignored, err := ignoredDirs(dh.repo())
+	if err != nil {
+		return nil, err
+	}
+	// Every directory holding a tracked path, including submodule paths.
+	occupied := make(map[string]bool)
+	for _, name := range tracked {
+		for dir := name; dir != "." && !occupied[dir]; dir = path.Dir(dir) {
+			occupied[dir] = true
+		}
+	}
+
+	head, err := headCommitTime(dh.repo())
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []FileModTime
+	err = filepath.Walk(dh.TargetDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() || p == dh.TargetDir {
+			return nil
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(dh.TargetDir, p)
+		if occupied[filepath.ToSlash(rel)] {
+			if _, err := os.Lstat(filepath.Join(p, ".git")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignored[filepath.ToSlash(rel)] {
+			return filepath.SkipDir
+		}
+		empty, err := isEmptyTree(p)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, FileModTime{Path: rel, LastModified: head, UnixTime: head.Unix(), IsDir: true})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list empty directories: %v", err)
+	}
+	slog.Info("Found directories without tracked files", "count", len(dirs), timeAttr(head))
+	return dirs, nil
+}
+
+// isEmptyTree reports whether dir holds nothing but directories, at any
+// depth. It stops at the first file it finds.
+func isEmptyTree(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			return false, nil
+		}
+		if empty, err := isEmptyTree(filepath.Join(dir, entry.Name())); err != nil || !empty {
+			return false, err
+		}
+	}
+	return true, nil
+}
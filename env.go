@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// envPrefix starts the environment variable for each option, so
+// --log-level can also be given as DOCHELPER_LOG_LEVEL.
+const envPrefix = "DOCHELPER_"
+
+// envName returns the environment variable for the flag called name.
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnv sets every flag not given on the command line from its
+// environment variable, looked up with lookup, so flags take precedence
+// over the environment and the environment over defaults. A repeatable
+// flag takes a single value from the environment.
+func applyEnv(fs *flag.FlagSet, lookup func(string) (string, bool)) error {
+	given := setFlags(fs)
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || given[f.Name] {
+			return
+		}
+		value, ok := lookup(envName(f.Name))
+		if !ok {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %v", envName(f.Name), setErr)
+		}
+	})
+	return err
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"DOCHELPER_WORKERS":   "4",
+		"DOCHELPER_LOG_LEVEL": "debug",
+		"DOCHELPER_DATE_KIND": "author",
+		"DOCHELPER_OUTPUT":    "times.csv",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	dh := NewDocHelper("", "", "")
+	fs := newFlagSet(dh)
+	if _, err := parseArgs(fs, []string{"--date-kind", "committer", ".", "document"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyEnv(fs, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if dh.Workers != 4 || dh.LogLevel != "debug" {
+		t.Errorf("workers %d, log level %q; want 4 and debug from the environment", dh.Workers, dh.LogLevel)
+	}
+	if dh.DateKind != "committer" {
+		t.Errorf("date kind %q, want the command line value committer", dh.DateKind)
+	}
+	if len(dh.Outputs) != 1 || dh.Outputs[0] != "times.csv" {
+		t.Errorf("outputs %v, want [times.csv]", dh.Outputs)
+	}
+
+	env = map[string]string{"DOCHELPER_WORKERS": "many"}
+	fs = newFlagSet(NewDocHelper("", "", ""))
+	if err := applyEnv(fs, lookup); err == nil {
+		t.Error("invalid DOCHELPER_WORKERS accepted")
+	}
+}
+
+func TestResolveArgsModeFromEnv(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "DOCHELPER_MODE" {
+			return "adjust", true
+		}
+		return "", false
+	}
+
+	// With the mode from the environment, a lone argument is the directory.
+	dh := NewDocHelper("", "", "")
+	mode, output, source, ok := resolveArgs(dh, []string{"."}, lookup)
+	if !ok || mode != "adjust" || output != "" || source != "env" {
+		t.Errorf("resolveArgs(.) = %q, %q, %q, %v; want adjust from env", mode, output, source, ok)
+	}
+	if len(dh.Dirs) != 1 || dh.Dirs[0] != "." {
+		t.Errorf("dirs %v, want [.]", dh.Dirs)
+	}
+
+	// Without a directory there is nothing to run, rather than a panic later.
+	dh = NewDocHelper("", "", "")
+	if _, _, _, ok := resolveArgs(dh, nil, lookup); ok {
+		t.Error("resolveArgs accepted a run without a directory")
+	}
+}
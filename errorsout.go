@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// failedFile is a record that could not be applied, with the reason. It
+// embeds FileModTime so a --errors-out document reads back as restore
+// input; readers ignore the extra error field.
+type failedFile struct {
+	FileModTime
+	Error string `json:"error"`
+}
+
+// writeErrorsFile writes the failed records to ErrorsOut, as CSV for a
+// .csv path and JSON otherwise. The file is replaced atomically; when
+// nothing failed, a file left by an earlier run is removed instead.
+func (dh *DocHelper) writeErrorsFile(failed []failedFile) error {
+	if len(failed) == 0 {
+		if err := os.Remove(dh.ErrorsOut); err == nil {
+			slog.Info("Removed errors file, nothing failed", "path", dh.ErrorsOut)
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("cannot remove errors file: %v", err)
+		}
+		return nil
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Path < failed[j].Path })
+
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(dh.ErrorsOut), ".csv") {
+		data, err = dh.errorsCSV(failed)
+	} else {
+		data, err = json.MarshalIndent(struct {
+			SchemaVersion int          `json:"schema_version"`
+			Files         []failedFile `json:"files"`
+		}{schemaVersion, failed}, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot serialize errors file: %v", err)
+	}
+
+	if err := writeFileAtomic(dh.ErrorsOut, data); err != nil {
+		return fmt.Errorf("cannot write errors file: %v", err)
+	}
+	slog.Info("Wrote errors file", "path", dh.ErrorsOut, "files", len(failed))
+	return nil
+}
+
+// errorsCSV writes failed with the usual CSV columns plus an error column.
+// Error messages often contain commas, so cells are quoted as needed.
+func (dh *DocHelper) errorsCSV(failed []failedFile) ([]byte, error) {
+	files := make([]FileModTime, len(failed))
+	for i, f := range failed {
+		files[i] = f.FileModTime
+	}
+	columns := dh.csvColumns(files)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := make([]string, 0, len(columns)+1)
+	for _, field := range columns {
+		header = append(header, dh.csvHeader(field))
+	}
+	w.Write(append(header, "error"))
+	for _, f := range failed {
+		row := make([]string, 0, len(columns)+1)
+		for _, field := range columns {
+			row = append(row, csvValue(f.FileModTime, field))
+		}
+		w.Write(append(row, f.Error))
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never see a partly written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestErrorsOut(t *testing.T) {
+	for _, ext := range []string{".json", ".csv"} {
+		t.Run(ext, func(t *testing.T) {
+			dir := t.TempDir()
+			// A plain file named docs makes docs/b.md fail with "not a directory".
+			writeFiles(t, dir, "a.md", "docs")
+			errorsOut := filepath.Join(t.TempDir(), "failed"+ext)
+
+			dh := newTestHelper(dir, nil)
+			dh.ErrorsOut = errorsOut
+			if err := dh.AdjustFileTimes(sampleFiles()); err == nil {
+				t.Fatal("expected an error when a file cannot be adjusted")
+			}
+
+			data, err := os.ReadFile(errorsOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), "error") {
+				t.Errorf("errors file has no error field:\n%s", data)
+			}
+
+			// The errors file reads back as restore input for a retry.
+			files, err := dh.loadDocument(errorsOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := sampleFiles()[1]
+			if len(files) != 1 || files[0].Path != want.Path || !files[0].LastModified.Equal(want.LastModified) {
+				t.Errorf("errors file records = %+v, want only %s", files, want.Path)
+			}
+
+			// Once the cause is fixed, the retry succeeds and clears the file.
+			if err := os.Remove(filepath.Join(dir, "docs")); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(t, dir, "docs/b.md")
+			if err := dh.AdjustFileTimes(files); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(errorsOut); !os.IsNotExist(err) {
+				t.Errorf("errors file still exists after a clean retry: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// isURL reports whether path is an http or https URL rather than a file.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// fetchDocument downloads the document at rawURL into memory within
+// Timeout. The format comes from the extension of the URL path, then from
+// the Content-Type header; ext is empty when neither names one. A URL path
+// ending in .gz is decompressed.
+func (dh *DocHelper) fetchDocument(rawURL string) (data []byte, ext string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	client := &http.Client{Timeout: dh.Timeout}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET %s: %s", u.Redacted(), resp.Status)
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if isGzipPath(u.Path) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", err
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, "", err
+		}
+	}
+
+	ext = documentExt(u.Path)
+	if readableFormat(ext) != nil {
+		return data, ext, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if format := formatByMediaType(mediaType); format != nil {
+		return data, format.ext, nil
+	}
+	return data, "", nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreFromURL(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "b.md")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/times.json":
+			w.Write([]byte(`[{"path": "a.md", "last_modified": "2023-11-14T22:13:20Z", "unix_time": 1700000000}]`))
+		case "/export":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Write([]byte("path,last_modified,unix_time\nb.md,2023-11-14 22:13:20,1700000000\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, path := range []string{"/times.json", "/export"} {
+		dh := NewDocHelper(dir, server.URL+path, "restore")
+		if err := dh.RestoreFromFile(dh.resolveOutput()); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+	for _, name := range []string{"a.md", "b.md"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ModTime().Unix() != 1700000000 {
+			t.Errorf("%s: mtime %d, want 1700000000", name, info.ModTime().Unix())
+		}
+	}
+
+	if err := NewDocHelper(dir, "", "restore").RestoreFromFile(server.URL + "/missing.json"); err == nil {
+		t.Error("404 accepted")
+	}
+}
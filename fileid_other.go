@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileKey returns a key identifying the file behind info. Platforms without
+// stable inode information fall back to the fully resolved path.
+func fileKey(path string, info os.FileInfo) string {
+	return resolvedKey(path)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hasFilters reports whether any of --include, --exclude or --ext is set.
+func (dh *DocHelper) hasFilters() bool {
+	return len(dh.Include) > 0 || len(dh.Exclude) > 0 || len(dh.Exts) > 0
+}
+
+// matchesFilters reports whether the path relative to TargetDir passes
+// --include, --exclude and --ext. A path must match one include glob when
+// any are given, no exclude glob, and one of the extensions when any are
+// given. Extensions are compared without case and with or without a dot.
+func (dh *DocHelper) matchesFilters(rel string) bool {
+	rel = filepath.ToSlash(rel)
+
+	if len(dh.Include) > 0 {
+		included := false
+		for _, pattern := range dh.Include {
+			if matchGlob(pattern, rel) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+
+	for _, pattern := range dh.Exclude {
+		if matchGlob(pattern, rel) {
+			return false
+		}
+	}
+
+	if len(dh.Exts) > 0 {
+		ext := strings.ToLower(filepath.Ext(rel))
+		for _, value := range dh.Exts {
+			for _, want := range strings.Split(value, ",") {
+				want = strings.ToLower(strings.TrimSpace(want))
+				if want != "" && ext == "."+strings.TrimPrefix(want, ".") {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// validateFilters rejects malformed --include and --exclude globs.
+func (dh *DocHelper) validateFilters() error {
+	for _, pattern := range append(append([]string{}, dh.Include...), dh.Exclude...) {
+		if !validGlob(pattern) {
+			return fmt.Errorf("invalid filter pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// parseMaxAge parses a --max-age value: a Go duration such as 2160h, or a
+// whole number of days such as 90d.
+func parseMaxAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("cannot parse age %q (use a duration such as 2160h or days such as 90d)", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("cannot parse age %q (use a duration such as 2160h or days such as 90d)", value)
+	}
+	return age, nil
+}
+
+// filterMaxAge drops files last modified more than MaxAge before now.
+func (dh *DocHelper) filterMaxAge(files []FileModTime, now time.Time) []FileModTime {
+	cutoff := now.Add(-dh.MaxAge)
+	var kept []FileModTime
+	for _, file := range files {
+		if file.LastModified.Before(cutoff) {
+			slog.Debug("Skipped file older than --max-age", "path", file.Path, timeAttr(file.LastModified))
+			continue
+		}
+		kept = append(kept, file)
+	}
+	slog.Info("Filtered by age", "kept", len(kept), "older", len(files)-len(kept), "since", cutoff)
+	return kept
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchesFilters(t *testing.T) {
+	dh := NewDocHelper(t.TempDir(), "", "document")
+	dh.Include = stringList{"content/**"}
+	dh.Exclude = stringList{"content/drafts/**"}
+	dh.Exts = stringList{"md,.HTML"}
+
+	cases := map[string]bool{
+		"content/a.md":                   true,
+		"content/posts/b.html":           true,
+		"content/posts/c.css":            false,
+		"content/drafts/d.md":            false,
+		"static/e.md":                    false,
+		filepath.Join("content", "f.MD"): true,
+	}
+	for path, want := range cases {
+		if got := dh.matchesFilters(path); got != want {
+			t.Errorf("matchesFilters(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestFiltersScanAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "content/a.md", "static/b.css")
+	at := time.Unix(1700000000, 0)
+
+	dh := newTestHelper(dir, fakeGit{"content/a.md": at, "static/b.css": at})
+	dh.Include = stringList{"content/**"}
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || filepath.ToSlash(files[0].Path) != "content/a.md" {
+		t.Errorf("scan = %+v, want only content/a.md", files)
+	}
+
+	doc := filepath.Join(t.TempDir(), "times.csv")
+	content := "path,last_modified,unix_time\ncontent/a.md,2023-11-14 22:13:20,1700000000\nstatic/b.css,2023-11-14 22:13:20,1700000000\n"
+	if err := os.WriteFile(doc, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restore := NewDocHelper(dir, doc, "restore")
+	restore.Include = stringList{"content/**"}
+	if err := restore.RestoreFromFile(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"content/a.md": true, "static/b.css": false} {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.ModTime().Unix() == 1700000000; got != want {
+			t.Errorf("%s restored = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestRestoreFiltersWithPathPrefix(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "content/a.md", "static/b.css")
+
+	doc := filepath.Join(t.TempDir(), "times.csv")
+	content := "path,last_modified,unix_time\n/docs/content/a.md,2023-11-14 22:13:20,1700000000\n/docs/static/b.css,2023-11-14 22:13:20,1700000000\n"
+	if err := os.WriteFile(doc, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restore := NewDocHelper(dir, doc, "restore")
+	restore.PathPrefix = "/docs/"
+	restore.Include = stringList{"content/**"}
+	if err := restore.RestoreFromFile(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"content/a.md": true, "static/b.css": false} {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.ModTime().Unix() == 1700000000; got != want {
+			t.Errorf("%s restored = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"90d":   90 * 24 * time.Hour,
+		"2160h": 2160 * time.Hour,
+	} {
+		got, err := parseMaxAge(value)
+		if err != nil || got != want {
+			t.Errorf("parseMaxAge(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "d", "-1d", "ninety days", "-5h"} {
+		if _, err := parseMaxAge(value); err == nil {
+			t.Errorf("parseMaxAge(%q) succeeded, want an error", value)
+		}
+	}
+
+	now := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	files := []FileModTime{
+		{Path: "recent.md", LastModified: now.AddDate(0, 0, -10)},
+		{Path: "old.md", LastModified: now.AddDate(-1, 0, 0)},
+	}
+	dh := NewDocHelper(t.TempDir(), "", "document")
+	dh.MaxAge = 90 * 24 * time.Hour
+	got := dh.filterMaxAge(files, now)
+	if len(got) != 1 || got[0].Path != "recent.md" {
+		t.Errorf("filterMaxAge = %+v, want only recent.md", got)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// documentFormat is one entry of the format registry. A format can be
+// written when generate is set and read back by restore when parse is set.
+type documentFormat struct {
+	name        string
+	ext         string
+	mediaType   string
+	description string
+	generate    func(dh *DocHelper, files []FileModTime, path string) error
+	parse       func(dh *DocHelper, data []byte) ([]FileModTime, *DocumentMetadata, error)
+}
+
+// documentFormats is the registry of supported document formats. The first
+// entry is the default for unrecognized output extensions.
+var documentFormats = []documentFormat{
+	{
+		name:        "json",
+		ext:         ".json",
+		mediaType:   "application/json",
+		description: "JSON document with schema version and metadata",
+		generate:    (*DocHelper).generateJSONDocument,
+		parse:       (*DocHelper).parseJSON,
+	},
+	{
+		name:        "csv",
+		ext:         ".csv",
+		mediaType:   "text/csv",
+		description: "comma-separated values with a header row",
+		generate:    (*DocHelper).generateCSVDocument,
+		parse: func(dh *DocHelper, data []byte) ([]FileModTime, *DocumentMetadata, error) {
+			files, err := dh.parseCSV(data)
+			return files, nil, err
+		},
+	},
+	{
+		name:        "markdown",
+		ext:         ".md",
+		mediaType:   "text/markdown",
+		description: "Markdown table for reading, not restorable",
+		generate:    (*DocHelper).generateMarkdownDocument,
+	},
+	{
+		name:        "table",
+		ext:         ".txt",
+		mediaType:   "text/plain",
+		description: "aligned plain-text table for terminals, not restorable",
+		generate:    (*DocHelper).generateTableDocument,
+	},
+	{
+		// Shares .json with the first entry, so it is only chosen by
+		// --format; restore tells the shapes apart by content.
+		name:        "unixmap",
+		ext:         ".json",
+		mediaType:   "application/json",
+		description: "flat JSON object of path to Unix time (--format unixmap)",
+		generate:    (*DocHelper).generateUnixMapDocument,
+		parse:       (*DocHelper).parseJSON,
+	},
+}
+
+// formatByExt returns the registered format for ext, such as ".csv", or nil.
+func formatByExt(ext string) *documentFormat {
+	for i := range documentFormats {
+		if documentFormats[i].ext == ext {
+			return &documentFormats[i]
+		}
+	}
+	return nil
+}
+
+// formatByName returns the registered format called name, such as "csv",
+// or nil.
+func formatByName(name string) *documentFormat {
+	for i := range documentFormats {
+		if documentFormats[i].name == name {
+			return &documentFormats[i]
+		}
+	}
+	return nil
+}
+
+// readableFormat returns the registered format for ext that restore can
+// read, or nil.
+func readableFormat(ext string) *documentFormat {
+	if format := formatByExt(ext); format != nil && format.parse != nil {
+		return format
+	}
+	return nil
+}
+
+// formatByMediaType returns the readable format a Content-Type names, such
+// as application/json or text/csv, or nil.
+func formatByMediaType(mediaType string) *documentFormat {
+	for i := range documentFormats {
+		format := &documentFormats[i]
+		if format.parse == nil {
+			continue
+		}
+		if mediaType == format.mediaType || strings.HasSuffix(mediaType, "+"+format.name) {
+			return format
+		}
+	}
+	return nil
+}
+
+// writeFormats lists the registered output and restore input formats.
+func writeFormats(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("Output formats (document mode, chosen by the output file extension or --format):\n")
+	for _, format := range documentFormats {
+		if format.generate != nil {
+			fmt.Fprintf(&b, "  %-10s %-6s %s\n", format.name, format.ext, format.description)
+		}
+	}
+	b.WriteString("\nInput formats (restore mode, also accepted with a .gz suffix):\n")
+	for _, format := range documentFormats {
+		if format.parse != nil {
+			fmt.Fprintf(&b, "  %-10s %s\n", format.name, format.ext)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
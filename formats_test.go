@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFormats(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeFormats(&buf); err != nil {
+		t.Fatal(err)
+	}
+	output, input, ok := strings.Cut(buf.String(), "Input formats")
+	if !ok {
+		t.Fatalf("no input section in %q", buf.String())
+	}
+	for _, format := range documentFormats {
+		if !strings.Contains(output, format.ext) {
+			t.Errorf("output formats lack %s", format.ext)
+		}
+		if got := strings.Contains(input, format.ext); got != (format.parse != nil) {
+			t.Errorf("input formats list %s = %v, want %v", format.ext, got, format.parse != nil)
+		}
+	}
+}
+
+func TestFormatLookup(t *testing.T) {
+	for ext, want := range map[string]bool{".json": true, ".csv": true, ".md": false, ".txt": false} {
+		if got := readableFormat(ext) != nil; got != want {
+			t.Errorf("readableFormat(%s) = %v, want %v", ext, got, want)
+		}
+	}
+	for mediaType, want := range map[string]string{
+		"application/json":         ".json",
+		"application/vnd.api+json": ".json",
+		"text/csv":                 ".csv",
+		"text/markdown":            "",
+	} {
+		got := ""
+		if format := formatByMediaType(mediaType); format != nil {
+			got = format.ext
+		}
+		if got != want {
+			t.Errorf("formatByMediaType(%s) = %q, want %q", mediaType, got, want)
+		}
+	}
+}
+
+func TestUnixMapRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "times.json")
+	dh := NewDocHelper(dir, "", "document")
+	dh.Format = "unixmap"
+	if err := dh.generateFile(sampleFiles(), output); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]int64
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("not a flat map: %v\n%s", err, data)
+	}
+	if m["a.md"] != 1700000000 || m["docs/b.md"] != 1710000000 {
+		t.Errorf("map = %v", m)
+	}
+
+	restored, _, err := dh.ReadFromJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, restored, sampleFiles())
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// gitRunner looks up the last commit time of a path relative to the
+// repository root, and the hash of the commit the time was taken from. A
+// zero time means git has no history for the path.
+type gitRunner interface {
+	LastModified(rel string) (at time.Time, commit string, err error)
+}
+
+// gitRepo locates a repository. Git runs in WorkTree; GitDir, when set,
+// points git at a repository kept elsewhere, as with git --git-dir. Prefix,
+// when set, is the slash-separated location of WorkTree within the
+// repository, for when git treats WorkTree as the top level but history
+// records paths from the real root.
+type gitRepo struct {
+	WorkTree string
+	GitDir   string
+	Prefix   string
+}
+
+// pathspec returns the pathspec naming rel, a path relative to WorkTree.
+func (r gitRepo) pathspec(rel string) string {
+	if r.Prefix == "" {
+		return rel
+	}
+	return ":(top)" + path.Join(r.Prefix, filepath.ToSlash(rel))
+}
+
+// scope appends a pathspec limiting a listing command to Prefix.
+func (r gitRepo) scope(args ...string) []string {
+	if r.Prefix == "" {
+		return args
+	}
+	return append(args, "--", ":(top)"+r.Prefix)
+}
+
+// relative maps a repository-relative path printed by git back to a path
+// relative to WorkTree, reporting false for paths outside Prefix.
+func (r gitRepo) relative(name string) (string, bool) {
+	if r.Prefix == "" {
+		return name, true
+	}
+	return strings.CutPrefix(name, r.Prefix+"/")
+}
+
+// command returns a git command with args for the repository.
+func (r gitRepo) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.WorkTree
+	if r.GitDir != "" {
+		cmd.Env = append(os.Environ(), "GIT_DIR="+r.GitDir, "GIT_WORK_TREE="+r.WorkTree)
+	}
+	return cmd
+}
+
+// execGitRunner answers lookups by running the git executable in Repo.
+// DateKind selects the commit date used: "committer" (default) or "author".
+// TaggedOnly prefers the newest tagged commit that touched the path.
+// Trailer, when set, names a commit trailer whose date overrides the
+// commit date of the newest commit that touched the path.
+type execGitRunner struct {
+	Repo       gitRepo
+	DateKind   string
+	TaggedOnly bool
+	Trailer    string
+	// CommitTZ keeps the time zone offset recorded in each commit instead
+	// of converting to the local zone.
+	CommitTZ bool
+	// SkipBulk, when positive, ignores commits touching more files than
+	// this, such as repository-wide reformats.
+	SkipBulk int
+	// Range, when set, is a revision range such as A..B limiting the
+	// commits considered. Paths with no commit in it have no history
+	// unless RangeFallback is set, which then looks at all of history.
+	Range         string
+	RangeFallback bool
+}
+
+// logArgs returns the arguments of a git log with options over Range,
+// limited to rel.
+func (g *execGitRunner) logArgs(rel string, options ...string) []string {
+	args := append([]string{"log"}, options...)
+	if g.Range != "" {
+		args = append(args, g.Range)
+	}
+	return append(args, "--", g.Repo.pathspec(rel))
+}
+
+// commitFormat returns the git log placeholders for a commit hash and its
+// date, as read back by parseGitCommit.
+func (g *execGitRunner) commitFormat() string {
+	return "%H " + g.dateFormat()
+}
+
+// dateFormat returns the git log placeholder for the configured date kind.
+func (g *execGitRunner) dateFormat() string {
+	switch {
+	case g.DateKind == "author" && g.CommitTZ:
+		return "%aI"
+	case g.DateKind == "author":
+		return "%at"
+	case g.CommitTZ:
+		return "%cI"
+	}
+	return "%ct"
+}
+
+func (g *execGitRunner) LastModified(rel string) (time.Time, string, error) {
+	t, commit, err := g.lookup(rel)
+	if err == nil && t.IsZero() && g.Range != "" && g.RangeFallback {
+		full := *g
+		full.Range = ""
+		return full.lookup(rel)
+	}
+	return t, commit, err
+}
+
+// lookup returns the last-modified time of rel within Range, and the
+// commit it was taken from.
+func (g *execGitRunner) lookup(rel string) (time.Time, string, error) {
+	if g.TaggedOnly {
+		return g.lastTagged(rel)
+	}
+	if g.Trailer != "" {
+		return g.lastTrailer(rel)
+	}
+	if g.SkipBulk > 0 {
+		return g.lastNonBulk(rel)
+	}
+
+	output, err := g.Repo.command(g.logArgs(rel, "-1", "--format="+g.commitFormat())...).Output()
+	if err != nil {
+		return time.Time{}, "", transientOrNil(err)
+	}
+
+	return parseGitCommit(string(output))
+}
+
+// lastTagged returns the date of the newest tagged commit that touched rel,
+// falling back to its newest commit when no tagged commit did.
+func (g *execGitRunner) lastTagged(rel string) (time.Time, string, error) {
+	output, err := runGit(g.Repo, g.logArgs(rel, "--format="+g.commitFormat()+"%x09%D", "--decorate-refs=refs/tags/")...)
+	if err != nil {
+		return time.Time{}, "", transientOrNil(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	for _, line := range lines {
+		commit, refs, _ := strings.Cut(line, "\t")
+		if strings.Contains(refs, "tag: ") {
+			return parseGitCommit(commit)
+		}
+	}
+
+	commit, _, _ := strings.Cut(lines[0], "\t")
+	return parseGitCommit(commit)
+}
+
+// lastTrailer returns the date in the Trailer trailer of the newest commit
+// that touched rel, falling back to its commit date when the trailer is
+// absent or cannot be parsed.
+func (g *execGitRunner) lastTrailer(rel string) (time.Time, string, error) {
+	output, err := runGit(g.Repo, g.logArgs(rel, "-1", "--format="+g.commitFormat()+"%x00%B")...)
+	if err != nil {
+		return time.Time{}, "", transientOrNil(err)
+	}
+
+	line, message, _ := strings.Cut(output, "\x00")
+	at, commit, err := parseGitCommit(line)
+	if value := trailerValue(message, g.Trailer); err == nil && value != "" {
+		t, err := parseDate(value)
+		if err == nil {
+			return t, commit, nil
+		}
+		slog.Warn("cannot parse trailer date, using the commit date", "path", rel, "trailer", g.Trailer, "error", err)
+	}
+	return at, commit, err
+}
+
+// trailerValue returns the value of the last trailer named key, compared
+// case-insensitively, in the final paragraph of a commit message.
+func trailerValue(message, key string) string {
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	value := ""
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		name, v, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), key) {
+			value = strings.TrimSpace(v)
+		}
+	}
+	return value
+}
+
+// transientGitError marks a git failure that may succeed when retried,
+// such as a fork failing on a loaded machine.
+type transientGitError struct {
+	err error
+}
+
+func (e *transientGitError) Error() string { return e.err.Error() }
+func (e *transientGitError) Unwrap() error { return e.err }
+
+// transientMarkers are git error messages that indicate a temporary
+// condition rather than a problem with the path.
+var transientMarkers = []string{
+	"resource temporarily unavailable",
+	"cannot fork",
+	"cannot allocate memory",
+	"index.lock",
+}
+
+// transientOrNil returns a transientGitError for failures worth retrying
+// and nil for any other failure, which callers treat as no history.
+func transientOrNil(err error) error {
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENOMEM) {
+		return &transientGitError{err}
+	}
+
+	message := err.Error()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		message += " " + string(exitErr.Stderr)
+	}
+	message = strings.ToLower(message)
+	for _, marker := range transientMarkers {
+		if strings.Contains(message, marker) {
+			return &transientGitError{err}
+		}
+	}
+	return nil
+}
+
+// parseGitCommit parses a line of git log output written with
+// commitFormat, returning the zero time and no commit for an empty line.
+func parseGitCommit(line string) (time.Time, string, error) {
+	commit, timestamp, _ := strings.Cut(strings.TrimSpace(line), " ")
+	t, err := parseGitTimestamp(timestamp)
+	if err != nil || t.IsZero() {
+		return t, "", err
+	}
+	return t, commit, nil
+}
+
+// parseGitTimestamp parses the output of git log --format=%ct or %at.
+func parseGitTimestamp(output string) (time.Time, error) {
+	timestampStr := strings.TrimSpace(output)
+	if timestampStr == "" {
+		return time.Time{}, nil
+	}
+
+	timestamp, err := strconv.ParseInt(timestampStr, 10, 64)
+	if err != nil {
+		// Strict ISO 8601 (%cI) carries the commit's own offset.
+		if t, isoErr := time.Parse(time.RFC3339, timestampStr); isoErr == nil {
+			return t, nil
+		}
+		return time.Time{}, err
+	}
+	return time.Unix(timestamp, 0), nil
+}
+
+// runGit runs git with args in repo and returns its standard output.
+func runGit(repo gitRepo, args ...string) (string, error) {
+	output, err := repo.command(args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return string(output), nil
+}
+
+// errGitNotFound reports that the git executable is not on PATH, which
+// would otherwise make every lookup come back without history.
+var errGitNotFound = errors.New("git executable not found in PATH")
+
+// checkGitInstalled returns errGitNotFound when the configured mode needs
+// git and it cannot be found. The PATH searched is logged at debug level.
+// Doctor reports a missing git in its own checklist, so it is never
+// stopped here.
+func (dh *DocHelper) checkGitInstalled() error {
+	needed := !dh.NoGit
+	switch dh.Mode {
+	case "restore":
+		needed = dh.CheckBounds || dh.TouchEmptyDirs
+	case "prune":
+		needed = dh.PruneUntracked
+	case "doctor":
+		needed = false
+	}
+	if !needed {
+		return nil
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		slog.Debug("Searched for git", "PATH", os.Getenv("PATH"), "error", err)
+		return errGitNotFound
+	}
+	return nil
+}
+
+// errNoCommits reports a repository whose HEAD has no commit yet, such as
+// one freshly created with git init.
+var errNoCommits = errors.New("repository has no commits yet")
+
+// headCommit returns the commit HEAD points to, or errNoCommits when the
+// repository has none.
+func headCommit(repo gitRepo) (string, error) {
+	output, err := repo.command("rev-parse", "--verify", "--quiet", "HEAD").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", errNoCommits
+		}
+		return "", fmt.Errorf("git rev-parse: %v", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// changedFiles returns the set of slash-separated paths that differ between
+// ref and HEAD. Renames are listed as both paths, so the old one drops out
+// of an updated document.
+func changedFiles(repo gitRepo, ref string) (map[string]bool, error) {
+	output, err := runGit(repo, repo.scope("diff", "--name-only", "--no-renames", ref+"..HEAD")...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list files changed since %s: %v", ref, err)
+	}
+
+	changed := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if rel, ok := repo.relative(line); ok && line != "" {
+			changed[rel] = true
+		}
+	}
+	return changed, nil
+}
+
+// ignoredDirs returns the slash-separated directories in repo that git
+// ignores, including ones holding nothing but ignored files.
+func ignoredDirs(repo gitRepo) (map[string]bool, error) {
+	output, err := runGit(repo, repo.scope("ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory", "--full-name")...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list ignored files: %v", err)
+	}
+
+	dirs := make(map[string]bool)
+	for _, name := range strings.Split(output, "\x00") {
+		if !strings.HasSuffix(name, "/") {
+			continue
+		}
+		if rel, ok := repo.relative(strings.TrimSuffix(name, "/")); ok {
+			dirs[rel] = true
+		}
+	}
+	return dirs, nil
+}
+
+// trackedFiles returns the slash-separated paths git tracks in repo.
+func trackedFiles(repo gitRepo) ([]string, error) {
+	output, err := runGit(repo, repo.scope("ls-files", "-z", "--full-name")...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list tracked files: %v", err)
+	}
+
+	var paths []string
+	for _, name := range strings.Split(output, "\x00") {
+		if rel, ok := repo.relative(name); ok && name != "" {
+			paths = append(paths, rel)
+		}
+	}
+	return paths, nil
+}
+
+// firstCommitTime returns the commit time of the oldest root commit
+// reachable from HEAD.
+func firstCommitTime(repo gitRepo) (time.Time, error) {
+	output, err := runGit(repo, "log", "--max-parents=0", "--format=%ct", "HEAD")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot find the first commit: %v", err)
+	}
+
+	var first time.Time
+	for _, line := range strings.Fields(output) {
+		t, err := parseGitTimestamp(line)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	if first.IsZero() {
+		return time.Time{}, errNoCommits
+	}
+	return first, nil
+}
+
+// headCommitTime returns the commit time of HEAD.
+func headCommitTime(repo gitRepo) (time.Time, error) {
+	output, err := runGit(repo, "log", "-1", "--format=%ct", "HEAD")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot find the latest commit: %v", err)
+	}
+	return parseGitTimestamp(output)
+}
+
+// firstAdded returns the time of the oldest commit that added rel, or the
+// zero time when git has no history for it.
+func (g *execGitRunner) firstAdded(rel string) (time.Time, error) {
+	output, err := runGit(g.Repo, "log", "--diff-filter=A", "--format="+g.dateFormat(), "--", g.Repo.pathspec(rel))
+	if err != nil {
+		return time.Time{}, err
+	}
+	lines := strings.Fields(output)
+	if len(lines) == 0 {
+		return time.Time{}, nil
+	}
+	return parseGitTimestamp(lines[len(lines)-1])
+}
+
+// lastNonBulk returns the date of the newest commit that touched rel and no
+// more than SkipBulk files in total, falling back to its newest commit when
+// every commit was a bulk change.
+func (g *execGitRunner) lastNonBulk(rel string) (time.Time, string, error) {
+	output, err := runGit(g.Repo, g.logArgs(rel, "--format=%x00"+g.commitFormat(), "--shortstat", "--full-diff")...)
+	if err != nil {
+		return time.Time{}, "", transientOrNil(err)
+	}
+
+	var newest string
+	for _, entry := range strings.Split(output, "\x00")[1:] {
+		commit, stat, _ := strings.Cut(entry, "\n")
+		if newest == "" {
+			newest = commit
+		}
+		// " 120 files changed, 300 insertions(+)"; merges have no stat.
+		changed := 0
+		if fields := strings.Fields(stat); len(fields) > 0 {
+			changed, _ = strconv.Atoi(fields[0])
+		}
+		if changed <= g.SkipBulk {
+			return parseGitCommit(commit)
+		}
+	}
+	return parseGitCommit(newest)
+}
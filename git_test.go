@@ -0,0 +1,745 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// initGitRepo creates a git repository in a temp directory, skipping the
+// test when git is not installed.
+func initGitRepo(t testing.TB) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q")
+	gitCmd(t, dir, "config", "user.email", "test@example.com")
+	gitCmd(t, dir, "config", "user.name", "Test")
+	return dir
+}
+
+func gitCmd(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	output, err := runGit(gitRepo{WorkTree: dir}, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+// commitFiles writes and commits paths with the given author date. File
+// contents include the date so every commit changes each path.
+func commitFiles(t testing.TB, dir, date string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(p+" "+date), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd(t, dir, append([]string{"add", "--"}, paths...)...)
+	gitCmd(t, dir, "-c", "core.hooksPath=/dev/null", "commit", "-q", "-m", "commit",
+		"--date", date)
+}
+
+func TestChangedSince(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md", "gone.md")
+	gitCmd(t, dir, "tag", "v1")
+
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "b.md", "docs/c.md", "gone.md")
+	gitCmd(t, dir, "rm", "-q", "gone.md")
+	gitCmd(t, dir, "commit", "-q", "-m", "remove")
+
+	dh := NewDocHelper(dir, "", "document")
+	dh.ChangedSince = "v1"
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, filepath.ToSlash(f.Path))
+	}
+	sort.Strings(paths)
+	if len(paths) != 2 || paths[0] != "b.md" || paths[1] != "docs/c.md" {
+		t.Errorf("got %v, want [b.md docs/c.md]", paths)
+	}
+
+	dh.ChangedSince = "no-such-ref"
+	if _, err := dh.ScanDirectory(); err == nil {
+		t.Error("expected an error for an unknown ref")
+	}
+}
+
+func TestDateKind(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-06-01T00:00:00Z")
+	commitFiles(t, dir, "2020-01-01T00:00:00Z", "a.md")
+
+	for kind, want := range map[string]string{
+		"":          "2024-06-01T00:00:00Z",
+		"committer": "2024-06-01T00:00:00Z",
+		"author":    "2020-01-01T00:00:00Z",
+	} {
+		dh := NewDocHelper(dir, "", "document")
+		dh.DateKind = kind
+		got, _, err := dh.GetGitLastModified(filepath.Join(dir, "a.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UTC().Format(time.RFC3339) != want {
+			t.Errorf("date kind %q: got %s, want %s", kind, got.UTC().Format(time.RFC3339), want)
+		}
+	}
+
+	dh := NewDocHelper(dir, "", "document")
+	dh.DateKind = "bogus"
+	if err := dh.Run(); err == nil {
+		t.Error("expected an error for an invalid date kind")
+	}
+}
+
+func TestMissingFiles(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "docs/b.md")
+	if err := os.Remove(filepath.Join(dir, "docs", "b.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	dh := NewDocHelper(dir, "", "document")
+	missing, err := dh.missingFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].Path != filepath.Join("docs", "b.md") || !missing[0].Missing {
+		t.Fatalf("unexpected missing files: %+v", missing)
+	}
+	if missing[0].LastModified.IsZero() {
+		t.Error("missing file should keep its git time")
+	}
+}
+
+func TestTaggedOnly(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md")
+	gitCmd(t, dir, "tag", "v1")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "a.md")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-03-01T00:00:00Z")
+	commitFiles(t, dir, "2024-03-01T00:00:00Z", "c.md")
+
+	dh := NewDocHelper(dir, "", "document")
+	dh.TaggedOnly = true
+	for path, want := range map[string]string{
+		"a.md": "2024-01-01T00:00:00Z", // untagged later change ignored
+		"b.md": "2024-01-01T00:00:00Z",
+		"c.md": "2024-03-01T00:00:00Z", // never tagged: newest commit
+	} {
+		got, _, err := dh.GetGitLastModified(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UTC().Format(time.RFC3339) != want {
+			t.Errorf("%s: got %s, want %s", path, got.UTC().Format(time.RFC3339), want)
+		}
+	}
+}
+
+func TestWorktreeAndGitDir(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+	want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	worktree := filepath.Join(t.TempDir(), "wt")
+	gitCmd(t, dir, "worktree", "add", "-q", worktree)
+
+	dh := NewDocHelper(worktree, "", "document")
+	if err := dh.checkRepo(); err != nil {
+		t.Fatalf("worktree not recognized: %v", err)
+	}
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "a.md" || !files[0].LastModified.Equal(want) {
+		t.Errorf("worktree scan got %+v, want only a.md at %s", files, want)
+	}
+
+	// A checkout with no .git at all, pointed at the repository explicitly.
+	checkout := t.TempDir()
+	if err := os.WriteFile(filepath.Join(checkout, "a.md"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dh = NewDocHelper(checkout, "", "document")
+	if err := dh.checkRepo(); err == nil {
+		t.Fatal("checkout without .git accepted")
+	}
+	dh.GitDir = filepath.Join(dir, ".git")
+	if err := dh.checkRepo(); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := dh.GetGitLastModified(filepath.Join(checkout, "a.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("--git-dir lookup got %s, want %s", got, want)
+	}
+}
+
+func TestNoCommits(t *testing.T) {
+	dir := initGitRepo(t)
+	writeFiles(t, dir, "a.md")
+
+	dh := NewDocHelper(dir, filepath.Join(t.TempDir(), "times.json"), "document")
+	if _, err := dh.scanRepo(); err != errNoCommits {
+		t.Errorf("scanRepo error = %v, want errNoCommits", err)
+	}
+	if err := dh.Run(); err != nil {
+		t.Errorf("Run on an empty repository: %v", err)
+	}
+	if _, err := os.Stat(dh.Output); !os.IsNotExist(err) {
+		t.Error("document written for an empty repository")
+	}
+
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+	head, err := headCommit(dh.repo())
+	if err != nil || head == "" {
+		t.Errorf("headCommit = %q, %v", head, err)
+	}
+}
+
+func TestFromTrailer(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-03-01T00:00:00Z")
+	commitFiles(t, dir, "2024-03-01T00:00:00Z", "a.md", "b.md")
+	if err := os.WriteFile(filepath.Join(dir, "a.md"), []byte("edited"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gitCmd(t, dir, "-c", "core.hooksPath=/dev/null", "commit", "-q", "-a",
+		"-m", "Edit a", "-m", "Published-Date: 2023-12-25T10:00:00Z")
+
+	dh := NewDocHelper(dir, "", "document")
+	dh.FromTrailer = "published-date"
+	for path, want := range map[string]string{
+		"a.md": "2023-12-25T10:00:00Z", // from the trailer
+		"b.md": "2024-03-01T00:00:00Z", // no trailer: commit date
+	} {
+		got, _, err := dh.GetGitLastModified(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UTC().Format(time.RFC3339) != want {
+			t.Errorf("%s: got %s, want %s", path, got.UTC().Format(time.RFC3339), want)
+		}
+	}
+}
+
+func TestTrailerValue(t *testing.T) {
+	message := "Title\n\nBody mentioning Published-Date: never.\n\nReviewed-by: someone\npublished-date: 2024-01-02\n"
+	if got := trailerValue(message, "Published-Date"); got != "2024-01-02" {
+		t.Errorf("got %q", got)
+	}
+	if got := trailerValue("Title only", "Published-Date"); got != "" {
+		t.Errorf("got %q for a message without trailers", got)
+	}
+}
+
+func TestGitPrefix(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "docs/a.md", "src/main.go")
+	gitCmd(t, dir, "tag", "v1")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "docs/b.md", "src/util.go")
+
+	// A copy of the docs subtree, pointed at the monorepo's history.
+	subtree := t.TempDir()
+	writeFiles(t, subtree, "a.md", "b.md")
+	dh := NewDocHelper(subtree, "", "document")
+	dh.GitDir = filepath.Join(dir, ".git")
+	dh.GitPrefix = "docs/"
+
+	got, _, err := dh.GetGitLastModified(filepath.Join(subtree, "b.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2024-02-01T00:00:00Z"; got.UTC().Format(time.RFC3339) != want {
+		t.Errorf("b.md: got %s, want %s", got.UTC().Format(time.RFC3339), want)
+	}
+
+	changed, err := changedFiles(dh.repo(), "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 || !changed["b.md"] {
+		t.Errorf("changed = %v, want only b.md", changed)
+	}
+
+	tracked, err := trackedFiles(dh.repo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tracked)
+	if len(tracked) != 2 || tracked[0] != "a.md" || tracked[1] != "b.md" {
+		t.Errorf("tracked = %v, want [a.md b.md]", tracked)
+	}
+}
+
+func TestTargetInsideRepository(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "docs/a.md", "src/main.go")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "docs/b.md")
+
+	dh := NewDocHelper(filepath.Join(dir, "docs"), "", "document")
+	if err := dh.checkRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if dh.GitPrefix != "docs/" {
+		t.Errorf("GitPrefix = %q, want docs/", dh.GitPrefix)
+	}
+
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2: %v", len(files), files)
+	}
+	for _, file := range files {
+		if file.Path != "a.md" && file.Path != "b.md" {
+			t.Errorf("unexpected path %q", file.Path)
+		}
+	}
+
+	tracked, err := trackedFiles(dh.repo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tracked)
+	if len(tracked) != 2 || tracked[0] != "a.md" || tracked[1] != "b.md" {
+		t.Errorf("tracked = %v, want [a.md b.md]", tracked)
+	}
+
+	if err := NewDocHelper(t.TempDir(), "", "document").checkRepo(); err == nil {
+		t.Error("expected an error outside any repository")
+	}
+}
+
+func TestCheckBounds(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md", "c.md")
+
+	before := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	within := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	future := time.Now().Add(48 * time.Hour)
+	document := func() []FileModTime {
+		return []FileModTime{
+			{Path: "a.md", LastModified: before},
+			{Path: "b.md", LastModified: within},
+			{Path: "c.md", LastModified: future},
+		}
+	}
+
+	dh := NewDocHelper(dir, "", "restore")
+	if _, err := dh.checkBounds(document()); err == nil {
+		t.Error("out-of-range times accepted")
+	}
+
+	dh.BoundsAction = "clamp"
+	files, err := dh.checkBounds(document())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !files[0].LastModified.Equal(want) {
+		t.Errorf("a.md = %s, want clamped to the first commit %s", files[0].LastModified, want)
+	}
+	if !files[1].LastModified.Equal(within) {
+		t.Errorf("b.md = %s, want unchanged", files[1].LastModified)
+	}
+	if !files[2].LastModified.Before(future) {
+		t.Errorf("c.md = %s, want clamped to now", files[2].LastModified)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md", "docs/c.md", "docs/d e.md")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "b.md", "docs/d e.md")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-03-01T00:00:00Z")
+	commitFiles(t, dir, "2024-03-01T00:00:00Z", "docs/c.md")
+
+	type found struct {
+		unix   int64
+		commit string
+	}
+	scan := func(batchSize int) map[string]found {
+		dh := NewDocHelper(dir, "", "document")
+		dh.BatchSize = batchSize
+		files, err := dh.ScanDirectory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		times := make(map[string]found)
+		for _, file := range files {
+			times[filepath.ToSlash(file.Path)] = found{file.UnixTime, file.commit}
+		}
+		return times
+	}
+
+	want := scan(0)
+	if len(want) != 4 || want["a.md"].commit == "" {
+		t.Fatalf("per-file scan found %v", want)
+	}
+	for _, size := range []int{1, 3, 100} {
+		got := scan(size)
+		for path, entry := range want {
+			if got[path] != entry {
+				t.Errorf("batch size %d: %s = %v, want %v", size, path, got[path], entry)
+			}
+		}
+	}
+}
+
+func TestSetBtime(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "a.md")
+
+	g := &execGitRunner{Repo: gitRepo{WorkTree: dir}}
+	added, err := g.firstAdded("a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2024-01-01T00:00:00Z"; added.UTC().Format(time.RFC3339) != want {
+		t.Errorf("firstAdded = %s, want %s", added.UTC().Format(time.RFC3339), want)
+	}
+
+	// Platforms without support only warn.
+	dh := NewDocHelper(dir, "", "adjust")
+	dh.SetBtime = true
+	at := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	if err := dh.AdjustFileTimes([]FileModTime{{Path: "a.md", LastModified: at}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitTZ(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T10:00:00+05:30")
+	commitFiles(t, dir, "2024-01-01T10:00:00+05:30", "a.md")
+
+	g := &execGitRunner{Repo: gitRepo{WorkTree: dir}, CommitTZ: true}
+	got, _, err := g.LastModified("a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2024-01-01T10:00:00+05:30"; got.Format(time.RFC3339) != want {
+		t.Errorf("got %s, want %s", got.Format(time.RFC3339), want)
+	}
+
+	g.CommitTZ = false
+	local, _, err := g.LastModified("a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !local.Equal(got) {
+		t.Errorf("the same instant expected without --commit-tz: %s vs %s", local, got)
+	}
+}
+
+func TestSkipBulkCommits(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md", "c.md")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "a.md")
+	small := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	t.Setenv("GIT_COMMITTER_DATE", "2024-03-01T00:00:00Z")
+	commitFiles(t, dir, "2024-03-01T00:00:00Z", "a.md", "b.md", "c.md")
+	bulk := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+
+	g := &execGitRunner{Repo: gitRepo{WorkTree: dir}, SkipBulk: 2}
+	for path, want := range map[string][2]string{
+		"a.md": {"2024-02-01T00:00:00Z", small},
+		// Every commit touching c.md was bulk, so its newest one is used.
+		"c.md": {"2024-03-01T00:00:00Z", bulk},
+	} {
+		got, commit, err := g.LastModified(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UTC().Format(time.RFC3339) != want[0] || commit != want[1] {
+			t.Errorf("%s: got %s %s, want %s %s", path, got.UTC().Format(time.RFC3339), commit, want[0], want[1])
+		}
+	}
+}
+
+func TestTouchEmptyDirs(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("node_modules/\ncache/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "docs/b.md")
+	gitCmd(t, dir, "add", ".gitignore")
+	gitCmd(t, dir, "-c", "core.hooksPath=/dev/null", "commit", "-q", "-m", "ignore", "--date", "2024-01-01T00:00:00Z")
+	for _, d := range []string{"old/empty", "docs/drafts", "node_modules/pkg", "cache", "build/empty"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Ignored and untracked trees holding files are left alone entirely.
+	writeFiles(t, dir, "node_modules/pkg/index.js", "build/out.bin")
+	untouched := []string{"node_modules", "node_modules/pkg", "cache", "build", "build/empty"}
+	before := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, d := range untouched {
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(d)), before, before); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dh := NewDocHelper(dir, "", "restore")
+	dh.TouchEmptyDirs = true
+	if err := dh.AdjustFileTimes(nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range untouched {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(d)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(before) {
+			t.Errorf("%s: mtime %v, want it left at %v", d, info.ModTime(), before)
+		}
+	}
+
+	head := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, d := range []string{"old", "old/empty", "docs/drafts"} {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(d)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(head) {
+			t.Errorf("%s: mtime %v, want %v", d, info.ModTime(), head)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Equal(head) {
+		t.Error("docs holds tracked files but was touched")
+	}
+}
+
+func TestCommitRange(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md")
+	gitCmd(t, dir, "tag", "v1")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "a.md")
+	gitCmd(t, dir, "tag", "v2")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-03-01T00:00:00Z")
+	commitFiles(t, dir, "2024-03-01T00:00:00Z", "a.md")
+
+	for _, fallback := range []string{"skip", "history"} {
+		for _, batch := range []int{0, 10} {
+			dh := NewDocHelper(dir, "", "document")
+			dh.CommitRange = "v1..v2"
+			dh.RangeFallback = fallback
+			dh.BatchSize = batch
+			files, err := dh.ScanDirectory()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]string)
+			for _, file := range files {
+				got[file.Path] = file.LastModified.UTC().Format(time.RFC3339)
+			}
+			want := map[string]string{"a.md": "2024-02-01T00:00:00Z"}
+			if fallback == "history" {
+				want["b.md"] = "2024-01-01T00:00:00Z"
+			}
+			if len(got) != len(want) || got["a.md"] != want["a.md"] || got["b.md"] != want["b.md"] {
+				t.Errorf("fallback %s, batch %d: got %v, want %v", fallback, batch, got, want)
+			}
+		}
+	}
+}
+
+func TestWithUntracked(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+	writeFiles(t, dir, "notes.txt")
+	mtime := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(dir, "notes.txt"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	dh := NewDocHelper(dir, "", "document")
+	dh.WithUntracked = true
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := make(map[string]string)
+	for _, file := range files {
+		sources[file.Path] = file.Source
+		if file.Path == "notes.txt" && !file.LastModified.Equal(mtime) {
+			t.Errorf("notes.txt dated %v, want its mtime %v", file.LastModified, mtime)
+		}
+	}
+	if len(sources) != 2 || sources["a.md"] != "" || sources["notes.txt"] != sourceFilesystem {
+		t.Errorf("sources = %v, want a.md from git and notes.txt from the file system", sources)
+	}
+
+	output := filepath.Join(t.TempDir(), "times.csv")
+	if err := dh.generateCSVDocument(files, output); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := dh.ReadFromCSV(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range restored {
+		if file.Source != sources[file.Path] {
+			t.Errorf("%s: source %q after CSV round trip, want %q", file.Path, file.Source, sources[file.Path])
+		}
+	}
+}
+
+func TestTiming(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md")
+
+	dh := NewDocHelper(dir, filepath.Join(t.TempDir(), "times.json"), "document")
+	dh.timing = &phaseTimes{}
+	if err := dh.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if n := dh.timing.lookups.Load(); n != 2 {
+		t.Errorf("git lookups = %d, want 2", n)
+	}
+	if dh.timing.scan.Load() < dh.timing.git.Load() || dh.timing.write.Load() == 0 {
+		t.Errorf("scan %d, git %d, write %d: want scan to include git and writing measured",
+			dh.timing.scan.Load(), dh.timing.git.Load(), dh.timing.write.Load())
+	}
+}
+
+func TestScanProgressFunc(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "docs/b.md")
+
+	dh := NewDocHelper(dir, "", "document")
+	var current []string
+	dh.ProgressFunc = func(done, total int, path string) {
+		if done != len(current)+1 || total != 0 {
+			t.Errorf("progress (%d, %d) after %d files, want (%d, 0)", done, total, len(current), len(current)+1)
+		}
+		current = append(current, path)
+	}
+	if _, err := dh.ScanDirectory(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(current, ",") != "a.md,docs/b.md" {
+		t.Errorf("progress reported %v, want a.md and docs/b.md", current)
+	}
+}
+
+// BenchmarkScanDirectory scans a fixture repository of 100 files spread
+// over 10 commits, looking files up one at a time and in batches.
+func BenchmarkScanDirectory(b *testing.B) {
+	dir := initGitRepo(b)
+	for c := 0; c < 10; c++ {
+		var paths []string
+		for f := c; f < 100; f += 10 {
+			paths = append(paths, filepath.ToSlash(filepath.Join("dir"+strconv.Itoa(f%5), "file"+strconv.Itoa(f)+".md")))
+		}
+		commitFiles(b, dir, time.Date(2024, 1, 1+c, 0, 0, 0, 0, time.UTC).Format(time.RFC3339), paths...)
+	}
+
+	for _, bench := range []struct {
+		name      string
+		batchSize int
+	}{{"per-file", 0}, {"batch", 500}} {
+		b.Run(bench.name, func(b *testing.B) {
+			dh := NewDocHelper(dir, "", "document")
+			dh.BatchSize = bench.batchSize
+			for i := 0; i < b.N; i++ {
+				files, err := dh.ScanDirectory()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(files) != 100 {
+					b.Fatalf("scanned %d files, want 100", len(files))
+				}
+			}
+		})
+	}
+}
+
+func TestTextOnly(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "data.bin")
+	for name, content := range map[string]string{
+		"logo.png":       "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		".gitattributes": "*.bin binary\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitCmd(t, dir, "add", "logo.png", ".gitattributes")
+	gitCmd(t, dir, "-c", "core.hooksPath=/dev/null", "commit", "-q", "-m", "assets", "--date", "2024-01-02T00:00:00Z")
+
+	for detect, want := range map[string]string{
+		"heuristic": ".gitattributes a.md data.bin",
+		"git":       ".gitattributes a.md",
+	} {
+		dh := NewDocHelper(dir, "", "document")
+		dh.TextOnly = true
+		dh.BinaryDetect = detect
+		files, err := dh.ScanDirectory()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, filepath.ToSlash(file.Path))
+		}
+		sort.Strings(paths)
+		if got := strings.Join(paths, " "); got != want {
+			t.Errorf("--binary-detect %s: got %s, want %s", detect, got, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.md", "a.md", true},
+		{"*.md", "docs/a.md", false},
+		{"content/**/*.md", "content/a.md", true},
+		{"content/**/*.md", "content/posts/2024/a.md", true},
+		{"content/**/*.md", "content/posts/a.html", false},
+		{"content/**/*.md", "other/a.md", false},
+		{"**", "any/depth/file", true},
+		{"docs/**", "docs", true},
+		{"docs/?.md", "docs/a.md", true},
+		{"docs/[ab].md", "docs/c.md", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	if validGlob("docs/[a") {
+		t.Error("malformed pattern reported valid")
+	}
+}
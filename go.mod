@@ -1,3 +1,7 @@
 module dochelper
 
 go 1.25.1
+
+require github.com/fsnotify/fsnotify v1.10.1
+
+require golang.org/x/sys v0.13.0
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+import "time"
+
+const lchtimesSupported = false
+
+func lchtimes(path string, atime, mtime time.Time) error {
+	return errLchtimesUnsupported
+}
@@ -0,0 +1,23 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// lchtimesSupported reports whether lchtimes can set a symlink's own times.
+const lchtimesSupported = true
+
+// lchtimes sets the access and modification times of path like os.Chtimes,
+// but changes a symlink itself rather than its target.
+func lchtimes(path string, atime, mtime time.Time) error {
+	ts := []unix.Timespec{unix.NsecToTimespec(atime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "lchtimes", Path: path, Err: err}
+	}
+	return nil
+}
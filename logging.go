@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// newLogger returns a logger writing to w at the named level ("debug",
+// "info", "warn" or "error") in the named format: "text" for people or
+// "json" for log pipelines.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level: %s (supported: debug, info, warn, error)", level)
+	}
+
+	switch format {
+	case "", "text":
+		return slog.New(&textHandler{w: w, level: lvl, mu: &sync.Mutex{}}), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: lvl})), nil
+	default:
+		return nil, fmt.Errorf("invalid log format: %s (supported: text, json)", format)
+	}
+}
+
+// textHandler writes one plain line per record: the message, prefixed with
+// "Warning: " or "Error: " above info level, followed by its attributes as
+// key=value pairs. Groups are flattened.
+type textHandler struct {
+	w     io.Writer
+	level slog.Level
+	attrs []slog.Attr
+	mu    *sync.Mutex
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString("Error: ")
+	case r.Level >= slog.LevelWarn:
+		b.WriteString("Warning: ")
+	}
+	b.WriteString(r.Message)
+
+	write := func(a slog.Attr) bool {
+		b.WriteString(" " + a.Key + "=" + formatValue(a.Value))
+		return true
+	}
+	for _, a := range h.attrs {
+		write(a)
+	}
+	r.Attrs(write)
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &clone
+}
+
+func (h *textHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// formatValue renders an attribute value, using the tool's usual time
+// layout and quoting values that would not read as a single token.
+func formatValue(v slog.Value) string {
+	v = v.Resolve()
+	var s string
+	if v.Kind() == slog.KindTime {
+		s = v.Time().Format("2006-01-02 15:04:05")
+	} else {
+		s = v.String()
+	}
+
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// Compile-time check that textHandler satisfies slog.Handler.
+var _ slog.Handler = (*textHandler)(nil)
+
+// logTime is the attribute key used for file times. It must differ from
+// slog.TimeKey, which JSON output uses for the record timestamp.
+const logTime = "modified"
+
+// timeAttr returns a file time attribute.
+func timeAttr(t time.Time) slog.Attr {
+	return slog.Time(logTime, t)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "info", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)
+	logger.Debug("hidden")
+	logger.Info("Adjusted", "path", "docs/a b.md", timeAttr(at))
+	logger.Warn("Skipped", "path", "c.md")
+	logger.With("path", "d.md").Error("cannot adjust time", "error", errors.New("denied"))
+
+	want := strings.Join([]string{
+		`Adjusted path="docs/a b.md" modified="2024-01-02 03:04:05"`,
+		`Warning: Skipped path=c.md`,
+		`Error: cannot adjust time path=d.md error=denied`,
+		``,
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "WARN", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("hidden")
+	logger.Warn("Skipped", "path", "c.md")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	if record[slog.LevelKey] != "WARN" || record[slog.MessageKey] != "Skipped" || record["path"] != "c.md" {
+		t.Errorf("got %v", record)
+	}
+}
+
+func TestNewLoggerRejectsInvalidOptions(t *testing.T) {
+	if _, err := newLogger(&bytes.Buffer{}, "loud", "text"); err == nil {
+		t.Error("invalid level accepted")
+	}
+	if _, err := newLogger(&bytes.Buffer{}, "info", "xml"); err == nil {
+		t.Error("invalid format accepted")
+	}
+}
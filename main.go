@@ -1,410 +1,2775 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
+// Exit codes reported by main, one per failure category.
+const (
+	exitUsage      = 1 // invalid arguments or any uncategorized error
+	exitTargetDir  = 2 // target directory missing or not a git repository
+	exitPartial    = 3 // some files could not be adjusted
+	exitOutputFile = 4 // the output document could not be written
+
+	exitInterrupted = 130 // interrupted by SIGINT, following the shell convention
+)
+
+// exitError tags an error with the exit code main should use for it.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// Errors callers can test for with errors.Is. They are returned wrapped,
+// with the path or detail appended.
+var (
+	ErrNotARepo          = errors.New("target directory is not inside a git repository")
+	ErrNoFiles           = errors.New("no file data found")
+	ErrUnsupportedFormat = errors.New("unsupported document format")
+	ErrMalformedDocument = errors.New("malformed document")
+	ErrInputMissing      = errors.New("input file does not exist")
+)
+
+// FileErrors reports that some files failed while others succeeded. Its
+// message is a summary; the failures, each prefixed with its path, are
+// joined with errors.Join so callers can inspect them with errors.Is and
+// errors.As or list them with Errors.
+type FileErrors struct {
+	summary string
+	err     error
+}
+
+func (e *FileErrors) Error() string { return e.summary }
+func (e *FileErrors) Unwrap() error { return e.err }
+
+// Errors returns the individual per-file failures.
+func (e *FileErrors) Errors() []error {
+	if joined, ok := e.err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return nil
+}
+
+// errorList collects per-file failures, including from concurrent workers.
+type errorList struct {
+	mu     sync.Mutex
+	errs   []error
+	failed []failedFile
+}
+
+func (l *errorList) add(file FileModTime, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errs = append(l.errs, fmt.Errorf("%s: %w", file.Path, err))
+	l.failed = append(l.failed, failedFile{FileModTime: file, Error: err.Error()})
+}
+
+// fileErrors returns nil when nothing failed, or a FileErrors with summary
+// and every collected failure.
+func (l *errorList) fileErrors(summary string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return &FileErrors{summary: summary, err: errors.Join(l.errs...)}
+}
+
+func withExitCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+// exitCode returns the exit code for err, defaulting to exitUsage.
+func exitCode(err error) int {
+	var ee *exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitUsage
+}
+
 type FileModTime struct {
-	Path         string    `json:"path"`
-	LastModified time.Time `json:"last_modified"`
-	UnixTime     int64     `json:"unix_time"`
+	Path         string      `json:"path"`
+	LastModified time.Time   `json:"last_modified"`
+	UnixTime     int64       `json:"unix_time"`
+	IsDir        bool        `json:"is_dir,omitempty"`
+	Missing      bool        `json:"missing,omitempty"`
+	Mode         os.FileMode `json:"mode,omitempty"`
+	Checksum     string      `json:"checksum,omitempty"`
+	// Source is sourceFilesystem when the time is a file system mtime
+	// rather than a git time, as for untracked files.
+	Source string `json:"source,omitempty"`
+	// commit is the hash of the commit the time was taken from, kept
+	// for xattr mode and not written to documents.
+	commit string
+}
+
+// sourceFilesystem marks a FileModTime dated by its file system mtime.
+const sourceFilesystem = "filesystem"
+
+// version is the tool version recorded in generated documents.
+var version = "dev"
+
+// DocumentMetadata describes how and from what a JSON document was generated.
+type DocumentMetadata struct {
+	GeneratedAt  time.Time `json:"generated_at"`
+	TargetDir    string    `json:"target_dir"`
+	ToolVersion  string    `json:"tool_version"`
+	FileCount    int       `json:"file_count"`
+	ManifestHash string    `json:"manifest_hash"`
+	// Commit is HEAD when the files were scanned; --update rescans only
+	// files changed since it.
+	Commit string `json:"commit,omitempty"`
+}
+
+// schemaVersion is the JSON document schema written by this version. Bump
+// it whenever FileModTime gains a field, and teach migrateFiles how to fill
+// the field in for older documents.
+//
+//	1: path, last_modified, unix_time
+//	2: is_dir
+//	3: missing
+//	4: mode
+//	5: checksum
+//	6: source
+const schemaVersion = 6
+
+// Document is the top-level layout of a JSON document. Older documents are
+// a bare array of files, which readers still accept as schema version 1.
+type Document struct {
+	SchemaVersion int               `json:"schema_version"`
+	Metadata      *DocumentMetadata `json:"metadata,omitempty"`
+	Files         []FileModTime     `json:"files"`
+}
+
+// migrateFiles fills in defaults for fields missing from documents written
+// with an older schema version.
+func migrateFiles(version int, files []FileModTime) {
+	if version > schemaVersion {
+		slog.Warn("document schema is newer than supported, unknown fields are ignored",
+			"schema_version", version, "supported", schemaVersion)
+	}
+
+	for i := range files {
+		// Every version: unix_time may be omitted or zero in hand-written documents.
+		if files[i].UnixTime == 0 && !files[i].LastModified.IsZero() {
+			files[i].UnixTime = files[i].LastModified.Unix()
+		}
+		// Likewise last_modified may be left out when unix_time is given.
+		if files[i].LastModified.IsZero() && files[i].UnixTime != 0 {
+			files[i].LastModified = time.Unix(files[i].UnixTime, 0)
+		}
+
+		// Version 1 had no directory entries.
+		if version < 2 {
+			files[i].IsDir = false
+		}
+
+		// Versions before 3 only listed files present on disk.
+		if version < 3 {
+			files[i].Missing = false
+		}
+
+		// Versions before 4 did not record permissions; leave them untouched.
+		if version < 4 {
+			files[i].Mode = 0
+		}
+
+		// Versions before 5 did not record content checksums.
+		if version < 5 {
+			files[i].Checksum = ""
+		}
+
+		// Versions before 6 only held git times.
+		if version < 6 {
+			files[i].Source = ""
+		}
+	}
+}
+
+// manifestHash returns a SHA-256 over the sorted file paths, identifying
+// the set of files a document describes independent of their order.
+func manifestHash(files []FileModTime) string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	sort.Strings(paths)
+
+	sum := sha256.Sum256([]byte(strings.Join(paths, "\n")))
+	return hex.EncodeToString(sum[:])
 }
 
 type DocHelper struct {
-	TargetDir string
-	Output    string
-	Mode      string
+	TargetDir      string
+	Output         string
+	Outputs        stringList // further documents written from the same scan
+	Mode           string
+	BaseDir        string
+	PathPrefix     string
+	ChangedSince   string
+	CachePath      string
+	GitDir         string
+	GitPrefix      string
+	DateKind       string
+	NoClobber      bool
+	Backup         bool
+	FollowSymlinks bool
+	// DedupeHardlinks collapses hardlinks to one record. It relies on inode
+	// information and is a no-op on platforms without it, such as Windows.
+	DedupeHardlinks bool
+	// DedupeByContent gives files with identical content the newest time
+	// among them.
+	DedupeByContent bool
+	Workers         int
+	GitRetries      int
+	BatchSize       int
+	Dirs            stringList
+	Merge           bool
+	GroupByDir      bool
+	RelativeTime    bool
+	SplitByDir      bool
+	MinTime         time.Time
+	MinTimeAction   string
+	CheckBounds     bool
+	BoundsAction    string
+	IncludeDirs     bool
+	PostAdjustCmd   string
+	Limit           int
+	ReportMissing   bool
+	IncludeMissing  bool
+	TaggedOnly      bool
+	FromTrailer     string
+	Update          bool
+	CountOnly       bool
+	FailOnZero      bool
+	Aggregates      stringList
+	KeepNewer       bool
+	NoGit           bool
+	SetBtime        bool
+	Preview         bool
+	CommitTZ        bool
+	MaxFiles        int
+	Confirm         bool
+	Yes             bool
+	Timeout         time.Duration
+	SkipBulk        int
+	WithChecksum    bool
+	RelativeTo      string
+	Bucket          string
+	SkipSubmodules  bool
+	Format          string
+	MaxAge          time.Duration
+	TouchEmptyDirs  bool
+	JSONShape       string
+	Append          bool
+	WithUntracked   bool
+	Top             int
+	NoFollowChtimes bool
+	Timing          bool
+	TextOnly        bool
+	BinaryDetect    string
+	LineEnding      string
+	StatePath       string
+	ErrorsOut       string
+	FromArchive     string
+	PrintConfig     bool
+	CommitRange     string
+	RangeFallback   string
+	MaxWidth        int
+	BucketFiles     bool
+	VerifyChecksum  bool
+	Include         stringList
+	Exclude         stringList
+	Exts            stringList
+	// FilenameTZ and FilenameDateFormat control how {date} and {time} in
+	// the output path are expanded.
+	FilenameTZ         string
+	FilenameDateFormat string
+	WithMode           bool
+	PruneUntracked     bool
+	JSONCompact        bool
+	Columns            []string
+	HeaderNames        map[string]string
+	Strict             bool
+	LogLevel           string
+	LogFormat          string
+	// ProgressFunc, when set, is called after each file ScanDirectory or
+	// AdjustFileTimes handles, with the slash-separated path. Calls never
+	// overlap, even with several workers. total is 0 while scanning, as the
+	// number of files is not known in advance.
+	ProgressFunc func(done, total int, current string)
+
+	git      gitRunner
+	cache    *gitCache
+	progress *adjustProgress
+	timing   *phaseTimes
+	commit   string // HEAD at the last scan, recorded in JSON metadata
+	// ctx, when set, is cancelled by Ctrl+C during adjust and restore.
+	ctx context.Context
+}
+
+// Outcomes of adjusting a single file.
+const (
+	outcomeAdjusted = iota
+	outcomeSkipped
+	outcomeFailed
+	outcomeNewer
+)
+
+// adjustProgress counts adjust outcomes as they happen, so an interrupted
+// run can still report how far it got.
+type adjustProgress struct {
+	adjusted, skipped, failed atomic.Int64
+	// newer counts files left alone by KeepNewer.
+	newer atomic.Int64
+}
+
+// add records one outcome. A nil progress ignores it.
+func (p *adjustProgress) add(outcome int) {
+	if p == nil {
+		return
+	}
+	switch outcome {
+	case outcomeAdjusted:
+		p.adjusted.Add(1)
+	case outcomeSkipped:
+		p.skipped.Add(1)
+	case outcomeFailed:
+		p.failed.Add(1)
+	case outcomeNewer:
+		p.newer.Add(1)
+	}
+}
+
+// progressReporter passes per-file progress to ProgressFunc, serializing
+// the calls so done only ever increases.
+type progressReporter struct {
+	mu    sync.Mutex
+	fn    func(done, total int, current string)
+	done  int
+	total int
+}
+
+// newProgressReporter returns a reporter for total files, or nil when no
+// ProgressFunc is set.
+func (dh *DocHelper) newProgressReporter(total int) *progressReporter {
+	if dh.ProgressFunc == nil {
+		return nil
+	}
+	return &progressReporter{fn: dh.ProgressFunc, total: total}
+}
+
+// step reports that the file at path is done. A nil reporter ignores it.
+func (p *progressReporter) step(path string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	p.fn(p.done, p.total, filepath.ToSlash(path))
+}
+
+func NewDocHelper(targetDir, output, mode string) *DocHelper {
+	return &DocHelper{
+		TargetDir:  targetDir,
+		Output:     output,
+		Mode:       mode,
+		Workers:    1,
+		GitRetries: 3,
+	}
+}
+
+// gitRetryBackoff is the wait before the first retry of a transient git
+// failure; it doubles for each further attempt.
+var gitRetryBackoff = 100 * time.Millisecond
+
+// GetGitLastModified returns the git time of filePath and the hash of the
+// commit it was taken from, retrying transient git failures up to
+// GitRetries attempts in total.
+func (dh *DocHelper) GetGitLastModified(filePath string) (time.Time, string, error) {
+	relPath, err := filepath.Rel(dh.TargetDir, filePath)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	defer dh.timing.track(phaseLookup, time.Now())
+	backoff := gitRetryBackoff
+	for attempt := 1; ; attempt++ {
+		lastModified, commit, err := dh.runner().LastModified(relPath)
+		var transient *transientGitError
+		if !errors.As(err, &transient) || attempt >= dh.GitRetries {
+			if err == nil && attempt > 1 {
+				slog.Info("git lookup succeeded after retry", "path", relPath, "attempts", attempt)
+			}
+			return lastModified, commit, err
+		}
+
+		slog.Warn("transient git failure, retrying", "path", relPath, "attempt", attempt, "error", err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// repo returns the repository git commands run against.
+func (dh *DocHelper) repo() gitRepo {
+	return gitRepo{
+		WorkTree: dh.TargetDir,
+		GitDir:   dh.GitDir,
+		Prefix:   strings.Trim(filepath.ToSlash(dh.GitPrefix), "/"),
+	}
+}
+
+// runner returns the git lookup in use, defaulting to running git in
+// TargetDir. While a scan has the cache loaded, lookups go through it.
+func (dh *DocHelper) runner() gitRunner {
+	if dh.cache != nil {
+		return dh.cache
+	}
+	if dh.git == nil {
+		dh.git = &execGitRunner{Repo: dh.repo(), DateKind: dh.DateKind, TaggedOnly: dh.TaggedOnly, Trailer: dh.FromTrailer, CommitTZ: dh.CommitTZ, SkipBulk: dh.SkipBulk,
+			Range: dh.CommitRange, RangeFallback: dh.RangeFallback == "history"}
+	}
+	return dh.git
+}
+
+// cacheOptions describes the options that change which time a lookup
+// finds, so --cache doesn't answer one set of options with times cached
+// for another.
+func (dh *DocHelper) cacheOptions() string {
+	return fmt.Sprintf("date-kind=%s,tagged-only=%t,from-trailer=%s,skip-bulk-commits=%d",
+		dh.DateKind, dh.TaggedOnly, dh.FromTrailer, dh.SkipBulk)
+}
+
+func (dh *DocHelper) ScanDirectory() ([]FileModTime, error) {
+	var files []FileModTime
+
+	var changed map[string]bool
+	if dh.ChangedSince != "" {
+		var err error
+		changed, err = changedFiles(dh.repo(), dh.ChangedSince)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Limiting scan to changed files", "count", len(changed), "since", dh.ChangedSince)
+	}
+
+	if dh.BatchSize > 0 {
+		start := time.Now()
+		batch, err := dh.loadBatch(dh.BatchSize, changed)
+		dh.timing.track(phaseGit, start)
+		if err != nil {
+			return nil, err
+		}
+		saved := dh.git
+		dh.git = batch
+		defer func() { dh.git = saved }()
+	}
+
+	if dh.CachePath != "" {
+		cache, err := loadGitCache(dh.CachePath, dh.cacheOptions(), dh.repo(), dh.runner())
+		if err != nil {
+			return nil, err
+		}
+		dh.cache = cache
+		defer func() {
+			dh.cache = nil
+			if err := cache.save(); err != nil {
+				slog.Warn("cannot write cache", "path", dh.CachePath, "error", err)
+			}
+		}()
+	}
+
+	var submodules map[string]bool
+	if dh.SkipSubmodules {
+		var err error
+		submodules, err = dh.submodulePaths()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var isBinary func(path, rel string) bool
+	if dh.TextOnly {
+		var err error
+		if isBinary, err = dh.binaryChecker(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Canonical path of each file seen, keyed by device and inode.
+	seenInodes := make(map[string]string)
+	// Files git has no history for, reported with FailOnZero.
+	var zeroTime []string
+	// Files that passed the filters, checked against MaxFiles.
+	candidates := 0
+	progress := dh.newProgressReporter(0)
+
+	err := dh.walk(func(path string, info os.FileInfo, err error) error {
+		if dh.Limit > 0 && len(files) >= dh.Limit {
+			return filepath.SkipAll
+		}
+		if dh.interrupted() {
+			return errInterrupted
+		}
+
+		if err != nil {
+			// Removed between listing its directory and visiting it.
+			if os.IsNotExist(err) && path != dh.TargetDir {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if rel, _ := filepath.Rel(dh.TargetDir, path); submodules[filepath.ToSlash(rel)] {
+				slog.Info("Skipped submodule", "path", rel)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Worktrees and separated git dirs have a .git file instead.
+		if info.Name() == ".git" {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(dh.TargetDir, path)
+		if changed != nil {
+			if !changed[filepath.ToSlash(relPath)] {
+				return nil
+			}
+			delete(changed, filepath.ToSlash(relPath))
+		}
+		if !dh.matchesFilters(relPath) {
+			return nil
+		}
+		if isBinary != nil && isBinary(path, filepath.ToSlash(relPath)) {
+			slog.Debug("Skipped binary file", "path", relPath)
+			return nil
+		}
+		candidates++
+		if dh.MaxFiles > 0 && candidates > dh.MaxFiles {
+			return fmt.Errorf("more than %d files to scan (--max-files); narrow the scan with --include, --exclude or --ext, or raise the limit", dh.MaxFiles)
+		}
+
+		if dh.DedupeHardlinks {
+			key := fileKey(path, info)
+			if canonical, ok := seenInodes[key]; ok {
+				slog.Warn("Skipped hardlink", "path", relPath, "of", canonical)
+				return nil
+			}
+			seenInodes[key] = relPath
+		}
+
+		// With NoGit the document is a plain inventory of file system mtimes.
+		var lastModified time.Time
+		var commit string
+		if dh.NoGit {
+			lastModified = info.ModTime()
+		} else {
+			lastModified, commit, err = dh.GetGitLastModified(dh.gitPath(path))
+		}
+		progress.step(relPath)
+		if _, statErr := os.Lstat(path); os.IsNotExist(statErr) {
+			slog.Warn("Skipped file removed during scan", "path", relPath)
+			return nil
+		}
+
+		if err != nil {
+			slog.Error("cannot get git modified time", "path", path, "error", err)
+			return nil
+		}
+
+		// Untracked files are listed by their mtime when asked to.
+		source := ""
+		if lastModified.IsZero() && dh.WithUntracked {
+			lastModified, source = info.ModTime(), sourceFilesystem
+		}
+		if lastModified.IsZero() {
+			if dh.FailOnZero {
+				zeroTime = append(zeroTime, relPath)
+			}
+			return nil
+		}
+
+		if !dh.MinTime.IsZero() && lastModified.Before(dh.MinTime) {
+			if dh.MinTimeAction == "skip" {
+				slog.Warn("Skipped file before --min-time", "path", relPath, timeAttr(lastModified))
+				return nil
+			}
+			slog.Info("Clamped", "path", relPath, timeAttr(lastModified), "to", dh.MinTime)
+			lastModified = dh.MinTime
+		}
+
+		file := FileModTime{
+			Path:         relPath,
+			LastModified: lastModified,
+			UnixTime:     lastModified.Unix(),
+			Source:       source,
+			commit:       commit,
+		}
+		if dh.WithMode {
+			file.Mode = info.Mode().Perm()
+		}
+		if dh.WithChecksum {
+			if file.Checksum, err = fileDigest(path); err != nil {
+				slog.Warn("cannot compute checksum", "path", relPath, "error", err)
+			}
+		}
+		files = append(files, file)
+
+		return nil
+	})
+
+	if dh.Limit > 0 && len(files) >= dh.Limit {
+		slog.Info("Stopped at --limit", "count", dh.Limit)
+	} else if len(changed) > 0 {
+		slog.Warn("Skipped changed files that no longer exist", "count", len(changed))
+	}
+
+	if err == nil && len(zeroTime) > 0 {
+		for _, path := range zeroTime {
+			slog.Error("no git history", "path", path)
+		}
+		err = fmt.Errorf("%d files have no git history (--fail-on-zero)", len(zeroTime))
+	}
+	return files, err
+}
+
+// walk visits every file under TargetDir. When FollowSymlinks is set,
+// symlinked directories are descended into and reported under their
+// link path, so callers always see paths rooted at TargetDir.
+func (dh *DocHelper) walk(fn filepath.WalkFunc) error {
+	if !dh.FollowSymlinks {
+		return filepath.Walk(dh.TargetDir, fn)
+	}
+	return dh.walkFollow(dh.TargetDir, dh.TargetDir, make(map[string]bool), fn)
+}
+
+func (dh *DocHelper) walkFollow(root, logicalRoot string, visited map[string]bool, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(root, path)
+		logicalPath := filepath.Join(logicalRoot, rel)
+		if err != nil {
+			return fn(logicalPath, info, err)
+		}
+
+		if info.IsDir() {
+			visited[fileKey(path, info)] = true
+			return fn(logicalPath, info, nil)
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 {
+			return fn(logicalPath, info, nil)
+		}
+
+		target, err := os.Stat(path)
+		if err != nil {
+			slog.Warn("skipping broken symlink", "path", logicalPath, "error", err)
+			return nil
+		}
+
+		if !target.IsDir() {
+			return fn(logicalPath, target, nil)
+		}
+
+		key := fileKey(path, target)
+		if visited[key] {
+			slog.Warn("skipping symlink cycle", "path", logicalPath)
+			return nil
+		}
+		visited[key] = true
+
+		realPath, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			slog.Warn("cannot resolve symlink", "path", logicalPath, "error", err)
+			return nil
+		}
+		return dh.walkFollow(realPath, logicalPath, visited, fn)
+	})
+}
+
+// gitPath returns the path to query git history for. With FollowSymlinks,
+// files reached through a symlink resolve to their real location, as long
+// as it stays inside TargetDir; anything outside keeps the link path.
+func (dh *DocHelper) gitPath(path string) string {
+	if !dh.FollowSymlinks {
+		return path
+	}
+
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+
+	realRoot, err := filepath.EvalSymlinks(dh.TargetDir)
+	if err != nil {
+		return path
+	}
+
+	rel, err := filepath.Rel(realRoot, realPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(dh.TargetDir, rel)
 }
 
-func NewDocHelper(targetDir, output, mode string) *DocHelper {
-	return &DocHelper{
-		TargetDir: targetDir,
-		Output:    output,
-		Mode:      mode,
+// resolvedKey identifies a path by its fully resolved location.
+func resolvedKey(path string) string {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return realPath
+}
+
+// errInterrupted is returned, with exitInterrupted, when Ctrl+C stops an
+// adjust, restore or scan before it finished.
+var errInterrupted = errors.New("interrupted")
+
+// interrupted reports whether ctx, when set, has been cancelled.
+func (dh *DocHelper) interrupted() bool {
+	return dh.ctx != nil && dh.ctx.Err() != nil
+}
+
+// errBirthTimeUnsupported is returned by setBirthTime on platforms that
+// cannot set creation times.
+var errBirthTimeUnsupported = errors.New("setting creation times is not supported on this platform")
+
+// errLchtimesUnsupported is returned by lchtimes on platforms that cannot
+// set the times of a symlink itself.
+var errLchtimesUnsupported = errors.New("setting symlink times is not supported on this platform")
+
+// chtimes sets the times of path, changing a symlink itself rather than
+// its target when NoFollowChtimes is set.
+func (dh *DocHelper) chtimes(path string, t time.Time) error {
+	if dh.NoFollowChtimes {
+		return lchtimes(path, t, t)
+	}
+	return os.Chtimes(path, t, t)
+}
+
+// setCreationTime sets the creation time of fullPath to the oldest commit
+// that added it, for SetBtime. Files without such a commit are left alone.
+func (dh *DocHelper) setCreationTime(fullPath, rel string) error {
+	g := &execGitRunner{Repo: dh.repo(), DateKind: dh.DateKind}
+	created, err := g.firstAdded(filepath.ToSlash(rel))
+	if err != nil || created.IsZero() {
+		return err
+	}
+	return setBirthTime(fullPath, created)
+}
+
+func (dh *DocHelper) AdjustFileTimes(files []FileModTime) error {
+	defer dh.timing.track(phaseWrite, time.Now())
+	if dh.TouchEmptyDirs {
+		empty, err := dh.emptyDirEntries()
+		if err != nil {
+			return err
+		}
+		files = append(files, empty...)
+	}
+	var state *adjustState
+	if dh.StatePath != "" {
+		var err error
+		if state, err = loadAdjustState(dh.StatePath); err != nil {
+			return err
+		}
+		files = state.pending(files)
+	}
+	if dh.Preview {
+		return dh.previewFileTimes(os.Stdout, files)
+	}
+	if dh.Confirm {
+		if err := dh.confirmAdjust(os.Stdin, isTerminal(os.Stdin), len(files)); err != nil {
+			return err
+		}
+	}
+	if state != nil {
+		if err := state.begin(); err != nil {
+			return err
+		}
+		defer state.close()
+	}
+
+	// counts covers this call; dh.progress, when set, accumulates across
+	// calls for the interrupt summary.
+	counts := &adjustProgress{}
+	record := func(outcome int) {
+		counts.add(outcome)
+		dh.progress.add(outcome)
+	}
+	var warnBirthTime sync.Once
+	var failures errorList
+	progress := dh.newProgressReporter(len(files))
+
+	// adjust applies one record and returns the log call describing the
+	// outcome, so concurrent workers can still log in input order.
+	adjust := func(file FileModTime) func() {
+		fullPath := filepath.Join(dh.TargetDir, file.Path)
+
+		if dh.KeepNewer {
+			stat := os.Stat
+			if dh.NoFollowChtimes {
+				stat = os.Lstat
+			}
+			if info, err := stat(fullPath); err == nil && info.ModTime().After(file.LastModified) {
+				record(outcomeNewer)
+				if state != nil {
+					state.markDone(file.Path)
+				}
+				return func() {
+					slog.Info("Kept newer local file", "path", file.Path, "mtime", info.ModTime(), timeAttr(file.LastModified))
+				}
+			}
+		}
+
+		err := dh.chtimes(fullPath, file.LastModified)
+		if os.IsNotExist(err) {
+			record(outcomeSkipped)
+			return func() { slog.Warn("Skipped file that no longer exists", "path", file.Path) }
+		}
+		if err != nil {
+			record(outcomeFailed)
+			failures.add(file, err)
+			return func() { slog.Error("cannot adjust time", "path", file.Path, "error", err) }
+		}
+
+		if file.Mode != 0 {
+			if err := os.Chmod(fullPath, file.Mode); err != nil {
+				record(outcomeFailed)
+				failures.add(file, err)
+				return func() { slog.Error("cannot set mode", "path", file.Path, "error", err) }
+			}
+		}
+
+		if dh.SetBtime {
+			err := dh.setCreationTime(fullPath, file.Path)
+			if errors.Is(err, errBirthTimeUnsupported) {
+				warnBirthTime.Do(func() { slog.Warn(err.Error() + ", --set-btime ignored") })
+			} else if err != nil {
+				record(outcomeFailed)
+				failures.add(file, err)
+				return func() { slog.Error("cannot set creation time", "path", file.Path, "error", err) }
+			}
+		}
+
+		record(outcomeAdjusted)
+		if state != nil {
+			state.markDone(file.Path)
+		}
+		return func() { slog.Info("Adjusted", "path", file.Path, timeAttr(file.LastModified)) }
+	}
+
+	// Directories go last, one at a time and deepest first, so no later
+	// change inside a directory can disturb a time already set on it.
+	regular, dirs := splitDirectories(files)
+	// Records an interrupt kept from being attempted.
+	var skipped []FileModTime
+	if dh.Workers <= 1 {
+		for i, file := range regular {
+			if dh.interrupted() {
+				skipped = append(skipped, regular[i:]...)
+				break
+			}
+			adjust(file)()
+			progress.step(file.Path)
+		}
+	} else {
+		// Collect log calls by index so the log keeps the input order.
+		messages := make([]func(), len(regular))
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < dh.Workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range jobs {
+					messages[i] = adjust(regular[i])
+					progress.step(regular[i].Path)
+				}
+			}()
+		}
+		for i := range regular {
+			if dh.interrupted() {
+				skipped = append(skipped, regular[i:]...)
+				break
+			}
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+
+		// Files never started because of an interrupt have no message.
+		for _, message := range messages {
+			if message != nil {
+				message()
+			}
+		}
+	}
+	for i, dir := range dirs {
+		if dh.interrupted() {
+			skipped = append(skipped, dirs[i:]...)
+			break
+		}
+		adjust(dir)()
+		progress.step(dir.Path)
+	}
+	interrupted := dh.interrupted()
+	if state != nil {
+		state.finish(!interrupted && counts.failed.Load() == 0)
+	}
+	if interrupted {
+		// The errors file lists everything still to do, so a retry from it
+		// covers the records never attempted as well as the failures.
+		if dh.ErrorsOut != "" {
+			for _, file := range skipped {
+				failures.failed = append(failures.failed, failedFile{FileModTime: file, Error: "not attempted before the interrupt"})
+			}
+			if len(failures.failed) > 0 {
+				if err := dh.writeErrorsFile(failures.failed); err != nil {
+					slog.Error(err.Error())
+				}
+			}
+		}
+		return withExitCode(exitInterrupted, errInterrupted)
+	}
+
+	if dh.KeepNewer {
+		slog.Info("Completed", "adjusted", counts.adjusted.Load(), "skipped", counts.skipped.Load(), "kept_newer", counts.newer.Load(), "failed", counts.failed.Load())
+	} else {
+		slog.Info("Completed", "adjusted", counts.adjusted.Load(), "skipped", counts.skipped.Load(), "failed", counts.failed.Load())
+	}
+	if dh.ErrorsOut != "" {
+		if err := dh.writeErrorsFile(failures.failed); err != nil {
+			return withExitCode(exitOutputFile, err)
+		}
+	}
+	if err := failures.fileErrors(fmt.Sprintf("failed to adjust %d of %d files", counts.failed.Load(), len(files))); err != nil {
+		return withExitCode(exitPartial, err)
+	}
+
+	if dh.PostAdjustCmd != "" {
+		return dh.runPostAdjust(counts.adjusted.Load(), counts.skipped.Load(), counts.failed.Load())
+	}
+	return nil
+}
+
+// runPostAdjust runs PostAdjustCmd through the shell with the adjust
+// summary in DOCHELPER_* environment variables. A non-zero exit of the
+// command becomes DocHelper's exit code.
+func (dh *DocHelper) runPostAdjust(adjusted, skipped, failed int64) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", dh.PostAdjustCmd)
+	} else {
+		cmd = exec.Command("sh", "-c", dh.PostAdjustCmd)
+	}
+	cmd.Dir = dh.TargetDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"DOCHELPER_TARGET_DIR="+dh.TargetDir,
+		fmt.Sprintf("DOCHELPER_ADJUSTED=%d", adjusted),
+		fmt.Sprintf("DOCHELPER_SKIPPED=%d", skipped),
+		fmt.Sprintf("DOCHELPER_FAILED=%d", failed),
+	)
+
+	slog.Info("Running post-adjust command", "command", dh.PostAdjustCmd)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return withExitCode(exitErr.ExitCode(), fmt.Errorf("post-adjust command failed: %v", err))
+		}
+		return fmt.Errorf("cannot run post-adjust command: %v", err)
+	}
+	return nil
+}
+
+func (dh *DocHelper) GenerateDocument(files []FileModTime) error {
+	defer dh.timing.track(phaseWrite, time.Now())
+	// Newest first; files sharing a time are ordered by their slash path so
+	// the document is the same whatever the walk order or platform.
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].LastModified.Equal(files[j].LastModified) {
+			return files[i].LastModified.After(files[j].LastModified)
+		}
+		return filepath.ToSlash(files[i].Path) < filepath.ToSlash(files[j].Path)
+	})
+	if dh.Top > 0 && len(files) > dh.Top {
+		slog.Info("Kept only the most recent files (--top)", "count", dh.Top, "of", len(files))
+		files = files[:dh.Top]
+	}
+
+	now := time.Now()
+	outputPaths := []string{dh.expandOutputName(dh.resolveOutput(), now)}
+	for _, output := range dh.Outputs {
+		outputPaths = append(outputPaths, dh.expandOutputName(dh.resolvePath(output), now))
+	}
+	files = dh.prefixPaths(slashPaths(files))
+
+	// Display file information like adjust mode
+	for _, file := range files {
+		slog.Info("Documented", "path", file.Path, timeAttr(file.LastModified))
+	}
+
+	// A table without an output file is printed for reading in place.
+	if dh.Format == "table" && dh.Output == "" && len(dh.Outputs) == 0 {
+		return dh.WriteTable(os.Stdout, files)
+	}
+	if dh.SplitByDir {
+		return dh.generateSplitDocuments(files, outputPaths[0])
+	}
+	for _, outputPath := range outputPaths {
+		if err := dh.generateFile(files, outputPath); err != nil {
+			return err
+		}
+	}
+	if len(outputPaths) > 1 {
+		slog.Info("Wrote documents", "count", len(outputPaths), "paths", strings.Join(outputPaths, ", "))
+	}
+	return nil
+}
+
+// generateFile writes files to outputPath in the registered format named by
+// Format or selected by its extension, defaulting to the first one, JSON.
+func (dh *DocHelper) generateFile(files []FileModTime, outputPath string) error {
+	if dh.Bucket != "" {
+		return dh.generateBucketDocument(files, outputPath)
+	}
+	if dh.Append {
+		return dh.appendCSVDocument(files, outputPath)
+	}
+	if dh.Format != "" {
+		format := formatByName(dh.Format)
+		if format == nil || format.generate == nil {
+			return fmt.Errorf("%w: unknown --format %s (see list-formats)", ErrUnsupportedFormat, dh.Format)
+		}
+		return format.generate(dh, files, outputPath)
+	}
+	format := formatByExt(documentExt(outputPath))
+	if format == nil || format.generate == nil {
+		format = &documentFormats[0]
+	}
+	return format.generate(dh, files, outputPath)
+}
+
+// generateSplitDocuments writes one document per top-level directory. When
+// the output is a directory, each document is named times-<dir>.json inside
+// it; otherwise the output file name is used as a template, so
+// meta/times.csv becomes meta/times-<dir>.csv.
+func (dh *DocHelper) generateSplitDocuments(files []FileModTime, outputPath string) error {
+	outputIsDir := strings.HasSuffix(dh.Output, "/") || strings.HasSuffix(dh.Output, string(filepath.Separator))
+	if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
+		outputIsDir = true
+	}
+	if outputIsDir {
+		if err := os.MkdirAll(outputPath, 0755); err != nil {
+			return withExitCode(exitOutputFile, fmt.Errorf("cannot create output directory: %v", err))
+		}
+		outputPath = filepath.Join(outputPath, "times.json")
+	}
+
+	groups := dh.groupByTopDir(files)
+	for _, group := range groups {
+		name := group.name
+		if name == "(root)" {
+			name = "root"
+		}
+		if err := dh.generateFile(group.files, suffixOutput(outputPath, name)); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Split files into documents", "files", len(files), "documents", len(groups))
+	return nil
+}
+
+// directoryEntries returns one entry per directory containing files, dated
+// by its newest file at any depth. TargetDir itself is not included.
+func directoryEntries(files []FileModTime) []FileModTime {
+	newest := make(map[string]time.Time)
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+		for dir := filepath.Dir(file.Path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			if file.LastModified.After(newest[dir]) {
+				newest[dir] = file.LastModified
+			}
+		}
+	}
+
+	dirs := make([]FileModTime, 0, len(newest))
+	for dir, lastModified := range newest {
+		dirs = append(dirs, FileModTime{
+			Path:         dir,
+			LastModified: lastModified,
+			UnixTime:     lastModified.Unix(),
+			IsDir:        true,
+		})
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Path < dirs[j].Path })
+	return dirs
+}
+
+// splitDirectories separates directory entries from the other records,
+// keeping the order of the others and sorting directories deepest first.
+func splitDirectories(files []FileModTime) (regular, dirs []FileModTime) {
+	for _, file := range files {
+		if file.IsDir {
+			dirs = append(dirs, file)
+		} else {
+			regular = append(regular, file)
+		}
+	}
+	depth := func(p string) int { return strings.Count(filepath.ToSlash(filepath.Clean(p)), "/") }
+	sort.SliceStable(dirs, func(i, j int) bool { return depth(dirs[i].Path) > depth(dirs[j].Path) })
+	return regular, dirs
+}
+
+// hasDirs reports whether any entry is a directory.
+func hasDirs(files []FileModTime) bool {
+	for _, file := range files {
+		if file.IsDir {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMissing reports whether any entry is missing from the working tree.
+func hasMissing(files []FileModTime) bool {
+	for _, file := range files {
+		if file.Missing {
+			return true
+		}
+	}
+	return false
+}
+
+// hasChecksum reports whether any entry records a content checksum.
+func hasChecksum(files []FileModTime) bool {
+	for _, file := range files {
+		if file.Checksum != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSource reports whether any entry is marked with a time source.
+func hasSource(files []FileModTime) bool {
+	for _, file := range files {
+		if file.Source != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMode reports whether any entry records permission bits.
+func hasMode(files []FileModTime) bool {
+	for _, file := range files {
+		if file.Mode != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// missingFiles returns entries for files git tracks but that are absent
+// from the working tree, dated by their last commit.
+func (dh *DocHelper) missingFiles() ([]FileModTime, error) {
+	tracked, err := trackedFiles(dh.repo())
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []FileModTime
+	for _, rel := range tracked {
+		if !dh.matchesFilters(rel) {
+			continue
+		}
+		path := filepath.Join(dh.TargetDir, filepath.FromSlash(rel))
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			continue
+		}
+
+		lastModified, _, _ := dh.GetGitLastModified(path)
+		missing = append(missing, FileModTime{
+			Path:         filepath.FromSlash(rel),
+			LastModified: lastModified,
+			UnixTime:     lastModified.Unix(),
+			Missing:      true,
+		})
+	}
+	return missing, nil
+}
+
+// slashPaths returns a copy of files with forward-slash paths, so documents
+// generated on Windows restore on other platforms and vice versa.
+func slashPaths(files []FileModTime) []FileModTime {
+	normalized := make([]FileModTime, len(files))
+	for i, file := range files {
+		file.Path = filepath.ToSlash(file.Path)
+		normalized[i] = file
+	}
+	return normalized
+}
+
+// prefixPaths returns a copy of files with PathPrefix prepended verbatim to
+// each path. It only shapes generated documents; restore never applies it.
+func (dh *DocHelper) prefixPaths(files []FileModTime) []FileModTime {
+	if dh.PathPrefix == "" {
+		return files
+	}
+
+	prefixed := make([]FileModTime, len(files))
+	for i, file := range files {
+		file.Path = dh.PathPrefix + file.Path
+		prefixed[i] = file
+	}
+	return prefixed
+}
+
+// resolveOutput returns the absolute output/input document path. An empty
+// Output defaults into TargetDir, an absolute Output is used as is, and a
+// relative Output is resolved against BaseDir, or the working directory
+// when BaseDir is unset.
+func (dh *DocHelper) resolveOutput() string {
+	if dh.Output == "" {
+		return filepath.Join(dh.TargetDir, "file_modification_times.json")
+	}
+	return dh.resolvePath(dh.Output)
+}
+
+// resolvePath resolves a document path given on the command line: absolute
+// paths are used as is, relative ones are resolved against BaseDir or the
+// working directory.
+func (dh *DocHelper) resolvePath(path string) string {
+	if filepath.IsAbs(path) || isURL(path) {
+		return path
+	}
+	if dh.BaseDir != "" {
+		return filepath.Join(dh.BaseDir, path)
+	}
+	if absPath, err := filepath.Abs(path); err == nil {
+		return absPath
+	}
+	return path
+}
+
+// expandOutputName replaces {date} and {time} in path with at, converted to
+// FilenameTZ. {date} uses FilenameDateFormat and {time} is HHMMSS, which is
+// safe in file names on every platform.
+func (dh *DocHelper) expandOutputName(path string, at time.Time) string {
+	if !strings.Contains(path, "{date}") && !strings.Contains(path, "{time}") {
+		return path
+	}
+
+	if loc, err := time.LoadLocation(dh.FilenameTZ); err == nil {
+		at = at.In(loc)
+	}
+	dateFormat := dh.FilenameDateFormat
+	if dateFormat == "" {
+		dateFormat = "2006-01-02"
+	}
+	return strings.NewReplacer("{date}", at.Format(dateFormat), "{time}", at.Format("150405")).Replace(path)
+}
+
+// documentExt returns the lowercase extension that selects a document's
+// format, looking past a trailing .gz so times.json.gz is treated as JSON.
+func documentExt(path string) string {
+	path = strings.ToLower(path)
+	return filepath.Ext(strings.TrimSuffix(path, ".gz"))
+}
+
+func isGzipPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gz")
+}
+
+// writeDocument writes data to path, gzip-compressing it when the path ends
+// in .gz. An existing file is overwritten unless NoClobber or Backup is set.
+func (dh *DocHelper) writeDocument(path string, data []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		if dh.NoClobber {
+			return fmt.Errorf("output file already exists: %s (--no-clobber)", path)
+		}
+		if dh.Backup {
+			if err := os.Rename(path, path+".bak"); err != nil {
+				return fmt.Errorf("cannot back up existing output: %v", err)
+			}
+			slog.Info("Backed up existing output", "path", path+".bak")
+		}
+	}
+
+	data = dh.withLineEnding(data)
+	if isGzipPath(path) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// withLineEnding returns data, written with LF line endings, using the
+// line ending chosen with --line-ending instead.
+func (dh *DocHelper) withLineEnding(data []byte) []byte {
+	crlf := dh.LineEnding == "crlf" || dh.LineEnding == "native" && runtime.GOOS == "windows"
+	if !crlf {
+		return data
+	}
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// readDocument reads path, transparently decompressing it when the path ends
+// in .gz.
+func readDocument(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || !isGzipPath(path) {
+		return data, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// WriteJSON writes files as a JSON document to w, with the metadata and
+// formatting options of dh. Paths are written as given.
+func (dh *DocHelper) WriteJSON(w io.Writer, files []FileModTime) error {
+	var doc any = Document{
+		SchemaVersion: schemaVersion,
+		Metadata: &DocumentMetadata{
+			GeneratedAt:  time.Now(),
+			TargetDir:    dh.TargetDir,
+			ToolVersion:  version,
+			FileCount:    len(files),
+			ManifestHash: manifestHash(files),
+			Commit:       dh.commit,
+		},
+		Files: files,
+	}
+	if dh.JSONShape == "map" {
+		doc = pathMap(files)
+	}
+
+	var data []byte
+	var err error
+	if dh.JSONCompact {
+		data, err = json.Marshal(doc)
+	} else {
+		data, err = json.MarshalIndent(doc, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot serialize JSON: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (dh *DocHelper) generateJSONDocument(files []FileModTime, outputPath string) error {
+	var buf bytes.Buffer
+	if err := dh.WriteJSON(&buf, files); err != nil {
+		return err
+	}
+
+	err := dh.writeDocument(outputPath, buf.Bytes())
+	if err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+
+	slog.Info("Generated JSON document", "path", outputPath, "files", len(files))
+	return nil
+}
+
+// WriteCSV writes files as a CSV document to w, with the columns and
+// headers selected on dh. Cells holding commas or quotes, such as unusual
+// paths, are quoted.
+func (dh *DocHelper) WriteCSV(w io.Writer, files []FileModTime) error {
+	writer := csv.NewWriter(w)
+	columns := dh.csvColumns(files)
+
+	headers := make([]string, len(columns))
+	for i, field := range columns {
+		headers[i] = dh.csvHeader(field)
+	}
+	writer.Write(headers)
+
+	values := make([]string, len(columns))
+	for _, file := range files {
+		for i, field := range columns {
+			values[i] = csvValue(file, field)
+		}
+		writer.Write(values)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (dh *DocHelper) generateCSVDocument(files []FileModTime, outputPath string) error {
+	var buf bytes.Buffer
+	if err := dh.WriteCSV(&buf, files); err != nil {
+		return err
+	}
+
+	err := dh.writeDocument(outputPath, buf.Bytes())
+	if err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+
+	slog.Info("Generated CSV document", "path", outputPath, "files", len(files))
+	return nil
+}
+
+// WriteMarkdown writes files as a Markdown document to w.
+func (dh *DocHelper) WriteMarkdown(w io.Writer, files []FileModTime) error {
+	var builder strings.Builder
+	builder.WriteString("# File modification times document\n\n")
+	builder.WriteString(fmt.Sprintf("Generated time: %s\n\n", time.Now().Format("2006-01-02 15:04:05")))
+	builder.WriteString(fmt.Sprintf("Target directory: %s\n\n", dh.TargetDir))
+	builder.WriteString(fmt.Sprintf("Total files: %d\n\n", len(files)))
+
+	if dh.GroupByDir {
+		for _, group := range dh.groupByTopDir(files) {
+			builder.WriteString(fmt.Sprintf("## %s\n\n", group.name))
+			dh.writeMarkdownTable(&builder, group.files)
+			builder.WriteString("\n")
+		}
+	} else {
+		builder.WriteString("## File list\n\n")
+		dh.writeMarkdownTable(&builder, files)
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func (dh *DocHelper) generateMarkdownDocument(files []FileModTime, outputPath string) error {
+	var buf bytes.Buffer
+	if err := dh.WriteMarkdown(&buf, files); err != nil {
+		return err
+	}
+
+	err := dh.writeDocument(outputPath, buf.Bytes())
+	if err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+
+	slog.Info("Generated Markdown document", "path", outputPath, "files", len(files))
+	return nil
+}
+
+func (dh *DocHelper) writeMarkdownTable(builder *strings.Builder, files []FileModTime) {
+	if dh.RelativeTime {
+		builder.WriteString("| File path | Last modified time | Age | Unix time |\n")
+		builder.WriteString("|---------|-------------|-----|-----------|\n")
+	} else {
+		builder.WriteString("| File path | Last modified time | Unix time |\n")
+		builder.WriteString("|---------|-------------|-----------|\n")
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		path := file.Path
+		if file.IsDir {
+			path += "/"
+		}
+
+		age := ""
+		if dh.RelativeTime {
+			age = " " + humanizeAge(now.Sub(file.LastModified)) + " |"
+		}
+		builder.WriteString(fmt.Sprintf("| %s | %s |%s %d |\n",
+			path,
+			file.LastModified.Format("2006-01-02 15:04:05"),
+			age,
+			file.UnixTime,
+		))
+	}
+}
+
+// humanizeAge renders an age like "3 days ago".
+func humanizeAge(age time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"year", 365 * 24 * time.Hour},
+		{"month", 30 * 24 * time.Hour},
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+	}
+
+	for _, unit := range units {
+		if n := int(age / unit.size); n >= 1 {
+			if n == 1 {
+				return fmt.Sprintf("1 %s ago", unit.name)
+			}
+			return fmt.Sprintf("%d %ss ago", n, unit.name)
+		}
+	}
+	return "just now"
+}
+
+// fileGroup is the set of files below one top-level directory.
+type fileGroup struct {
+	name  string
+	files []FileModTime
+}
+
+// groupByTopDir groups files by their top-level directory, ignoring any
+// PathPrefix. Files at the root form a "(root)" group. Groups are ordered by
+// their newest file, and files keep their relative order within a group.
+func (dh *DocHelper) groupByTopDir(files []FileModTime) []fileGroup {
+	var groups []fileGroup
+	index := make(map[string]int)
+	for _, file := range files {
+		name := "(root)"
+		rel := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(file.Path, dh.PathPrefix)), "/")
+		if dir, _, ok := strings.Cut(rel, "/"); ok {
+			name = dir
+		}
+
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, fileGroup{name: name})
+		}
+		groups[i].files = append(groups[i].files, file)
+	}
+
+	newest := func(g fileGroup) time.Time {
+		var t time.Time
+		for _, file := range g.files {
+			if file.LastModified.After(t) {
+				t = file.LastModified
+			}
+		}
+		return t
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return newest(groups[i]).After(newest(groups[j]))
+	})
+	return groups
+}
+
+// ReadFromJSON reads a JSON document, returning its files and, for documents
+// written with a metadata block, the metadata. Legacy bare-array documents
+// return nil metadata.
+func (dh *DocHelper) ReadFromJSON(inputPath string) ([]FileModTime, *DocumentMetadata, error) {
+	data, err := readDocument(inputPath)
+	if os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInputMissing, inputPath)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read file: %w", err)
+	}
+	return dh.parseJSON(data)
+}
+
+// parseJSON decodes a JSON document, or a bare array of records, migrating
+// records from older schema versions.
+func (dh *DocHelper) parseJSON(data []byte) ([]FileModTime, *DocumentMetadata, error) {
+	var doc Document
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &doc.Files)
+	} else if isPathMap(data) {
+		doc.Files, err = parsePathMap(data)
+		doc.SchemaVersion = schemaVersion
+	} else if isUnixMap(data) {
+		doc.Files, err = parseUnixMap(data)
+		doc.SchemaVersion = schemaVersion
+	} else {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: cannot parse JSON: %v", ErrMalformedDocument, err)
+	}
+
+	// Documents without a schema version predate versioning.
+	if doc.SchemaVersion == 0 {
+		doc.SchemaVersion = 1
+	}
+	migrateFiles(doc.SchemaVersion, doc.Files)
+	if err := dh.checkTimes(doc.Files); err != nil {
+		return nil, nil, err
+	}
+
+	return doc.Files, doc.Metadata, nil
+}
+
+// checkTimes flags records whose unix_time contradicts last_modified, which
+// usually means a hand-edited document. With Strict this is an error;
+// otherwise last_modified, the time restore applies, wins with a warning.
+func (dh *DocHelper) checkTimes(files []FileModTime) error {
+	mismatched := 0
+	for i, file := range files {
+		if file.LastModified.Unix() == file.UnixTime {
+			continue
+		}
+		mismatched++
+		if dh.Strict {
+			slog.Error("unix_time does not match last_modified", "path", file.Path,
+				"unix_time", file.UnixTime, "last_modified", file.LastModified)
+			continue
+		}
+		slog.Warn("unix_time does not match last_modified, using last_modified", "path", file.Path,
+			"unix_time", file.UnixTime, "last_modified", file.LastModified)
+		files[i].UnixTime = file.LastModified.Unix()
+	}
+
+	if mismatched > 0 && dh.Strict {
+		return fmt.Errorf("%d records have unix_time and last_modified that disagree (--strict)", mismatched)
+	}
+	return nil
+}
+
+func (dh *DocHelper) ReadFromCSV(inputPath string) ([]FileModTime, error) {
+	data, err := readDocument(inputPath)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrInputMissing, inputPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file: %w", err)
+	}
+	return dh.parseCSV(data)
+}
+
+// parseCSV decodes a CSV document.
+func (dh *DocHelper) parseCSV(data []byte) ([]FileModTime, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot read CSV: %v", ErrMalformedDocument, err)
+	}
+
+	if len(records) < 2 {
+		return nil, fmt.Errorf("CSV file is empty or missing header")
+	}
+
+	// Columns are located by header name, mapped back through
+	// --header-names. Documents without a path header are read positionally
+	// as path, last_modified, unix_time.
+	columns := make(map[string]int)
+	for i, header := range records[0] {
+		columns[dh.csvField(header)] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		columns["path"], columns["last_modified"], columns["unix_time"] = 0, 1, 2
+	}
+	column := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return record[i]
+	}
+
+	var files []FileModTime
+	for i := 1; i < len(records); i++ {
+		record := records[i]
+		path := column(record, "path")
+		if path == "" {
+			continue
+		}
+
+		var lastModified time.Time
+		unixTime, err := strconv.ParseInt(column(record, "unix_time"), 10, 64)
+		if err != nil {
+			lastModified, err = parseCSVTime(column(record, "last_modified"))
+			if err != nil {
+				slog.Warn("cannot parse time", "path", path, "error", err)
+				continue
+			}
+			unixTime = lastModified.Unix()
+		} else {
+			lastModified = time.Unix(unixTime, 0)
+		}
+
+		file := FileModTime{
+			Path:         path,
+			LastModified: lastModified,
+			UnixTime:     unixTime,
+		}
+		file.IsDir, _ = strconv.ParseBool(column(record, "is_dir"))
+		file.Missing, _ = strconv.ParseBool(column(record, "missing"))
+		if mode := column(record, "mode"); mode != "" {
+			if perm, err := strconv.ParseUint(mode, 8, 32); err == nil {
+				file.Mode = os.FileMode(perm)
+			}
+		}
+		file.Checksum = column(record, "checksum")
+		file.Source = column(record, "source")
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// RestoreFromFile restores file times from a document, or from every
+// document in inputPath when it is a directory.
+func (dh *DocHelper) RestoreFromFile(inputPath string) error {
+	var info os.FileInfo
+	var err error
+	if !isURL(inputPath) {
+		info, err = os.Stat(inputPath)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrInputMissing, inputPath)
+		}
+	}
+
+	if _, err := os.Stat(dh.TargetDir); os.IsNotExist(err) {
+		return withExitCode(exitTargetDir, fmt.Errorf("target directory does not exist: %s", dh.TargetDir))
+	}
+
+	var files []FileModTime
+	if info != nil && info.IsDir() {
+		files, err = dh.loadDocumentDir(inputPath)
+	} else {
+		files, err = dh.loadDocument(inputPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("%w in input file", ErrNoFiles)
+	}
+
+	// Records written with --path-prefix name files relative to TargetDir
+	// once the prefix is stripped, for the filters and the restore alike.
+	for i := range files {
+		files[i].Path = strings.TrimPrefix(files[i].Path, dh.PathPrefix)
+	}
+
+	if dh.hasFilters() {
+		var kept []FileModTime
+		for _, file := range files {
+			if dh.matchesFilters(file.Path) {
+				kept = append(kept, file)
+			}
+		}
+		slog.Info("Filtered records", "kept", len(kept), "filtered_out", len(files)-len(kept))
+		if len(kept) == 0 {
+			slog.Warn("no records match the filters, nothing to restore")
+			return nil
+		}
+		files = kept
+	}
+
+	if dh.Limit > 0 && len(files) > dh.Limit {
+		slog.Info("Restoring only the first files (--limit)", "count", dh.Limit, "of", len(files))
+		files = files[:dh.Limit]
+	}
+
+	for i := range files {
+		files[i].Path = filepath.FromSlash(files[i].Path)
+	}
+
+	if dh.CheckBounds {
+		if files, err = dh.checkBounds(files); err != nil {
+			return err
+		}
+	}
+
+	if dh.VerifyChecksum {
+		files = dh.verifyChecksums(files)
+	}
+
+	return dh.AdjustFileTimes(files)
+}
+
+// loadDocument reads a single JSON or CSV document from a file or an
+// http(s) URL, warning when its metadata suggests it is stale. The format
+// follows the extension, then for URLs the Content-Type, or else the
+// content.
+func (dh *DocHelper) loadDocument(inputPath string) ([]FileModTime, error) {
+	ext := documentExt(inputPath)
+	var data []byte
+	var err error
+
+	slog.Info("Reading from file", "path", inputPath)
+	if isURL(inputPath) {
+		data, ext, err = dh.fetchDocument(inputPath)
+	} else {
+		data, err = readDocument(inputPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file: %w", err)
+	}
+
+	format := readableFormat(ext)
+	if format == nil {
+		sniffed, err := sniffData(data, inputPath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read file: %w", err)
+		}
+		slog.Info("Unrecognized extension, format detected from content", "extension", ext, "format", sniffed)
+		format = readableFormat(sniffed)
+	}
+
+	files, metadata, err := format.parse(dh, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file: %w", err)
+	}
+
+	slog.Info("Loaded files", "path", inputPath, "files", len(files))
+	if metadata != nil {
+		slog.Info("Document metadata", "generated_at", metadata.GeneratedAt, "tool_version", metadata.ToolVersion)
+		dh.warnIfStale(files, metadata)
+	}
+	return files, nil
+}
+
+// sniffFormat guesses the document format of path from its first
+// non-whitespace byte: '[' or '{' is JSON, anything else is tried as CSV.
+func sniffFormat(path string) (string, error) {
+	data, err := readDocument(path)
+	if err != nil {
+		return "", err
+	}
+	return sniffData(data, path)
+}
+
+// sniffData guesses the format of the document data read from name.
+func sniffData(data []byte, name string) (string, error) {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 {
+		return "", fmt.Errorf("%s is empty", name)
+	}
+	if data[0] == '[' || data[0] == '{' {
+		return ".json", nil
+	}
+	return ".csv", nil
+}
+
+// loadDocumentDir reads and merges every JSON and CSV document directly
+// inside dir. A path listed in several documents keeps its newest time.
+func (dh *DocHelper) loadDocumentDir(dir string) ([]FileModTime, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory: %v", err)
+	}
+
+	var merged []FileModTime
+	index := make(map[string]int)
+	documents := 0
+	for _, entry := range entries {
+		if entry.IsDir() || readableFormat(documentExt(entry.Name())) == nil {
+			continue
+		}
+
+		files, err := dh.loadDocument(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		documents++
+
+		for _, file := range files {
+			i, seen := index[file.Path]
+			if !seen {
+				index[file.Path] = len(merged)
+				merged = append(merged, file)
+				continue
+			}
+
+			if file.LastModified.After(merged[i].LastModified) {
+				merged[i] = file
+			}
+			slog.Warn("file is listed in several documents, using newest time",
+				"path", file.Path, timeAttr(merged[i].LastModified))
+		}
+	}
+
+	if documents == 0 {
+		return nil, fmt.Errorf("no .json or .csv documents found in %s", dir)
+	}
+	slog.Info("Merged documents", "files", len(merged), "documents", documents)
+	return merged, nil
+}
+
+// warnIfStale prints warnings when a document no longer matches itself or
+// the target directory, which usually means it was generated against an
+// older version of the tree.
+func (dh *DocHelper) warnIfStale(files []FileModTime, metadata *DocumentMetadata) {
+	if metadata.FileCount != len(files) {
+		slog.Warn("document file count does not match its metadata", "files", len(files), "metadata", metadata.FileCount)
+	}
+
+	if metadata.ManifestHash != "" && metadata.ManifestHash != manifestHash(files) {
+		slog.Warn("document file list does not match its manifest hash, it may have been edited")
+	}
+
+	missing := 0
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(dh.TargetDir, file.Path)); os.IsNotExist(err) {
+			missing++
+		}
+	}
+	if missing > 0 {
+		slog.Warn("documented files no longer exist, the document may be stale", "missing", missing, "files", len(files))
+	}
+}
+
+// processScanned applies the steps shared by single and merged runs to the
+// files scanned from TargetDir: content dedupe, aggregates and --max-age,
+// then, when a document will be written, directory entries and the
+// missing-file report.
+func (dh *DocHelper) processScanned(files []FileModTime) ([]FileModTime, error) {
+	if dh.DedupeByContent {
+		files = dh.dedupeByContent(files)
+	}
+	files = dh.applyAggregates(files)
+	if dh.MaxAge > 0 {
+		files = dh.filterMaxAge(files, time.Now())
+	}
+	if dh.Mode != "document" || dh.CountOnly || len(files) == 0 {
+		return files, nil
+	}
+
+	if dh.IncludeDirs {
+		files = append(files, directoryEntries(files)...)
+	}
+	if dh.ReportMissing || dh.IncludeMissing {
+		missing, err := dh.missingFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range missing {
+			slog.Warn("Missing: tracked by git but not in the working tree", "path", file.Path)
+		}
+		if len(missing) > 0 {
+			slog.Warn("tracked files are missing, the checkout may be broken", "count", len(missing))
+		}
+		if dh.IncludeMissing {
+			files = append(files, missing...)
+		}
+	}
+	return files, nil
+}
+
+func (dh *DocHelper) Run() error {
+	if err := dh.validateOptions(); err != nil {
+		return err
+	}
+	if dh.Timing && dh.timing == nil {
+		dh.timing = &phaseTimes{}
+		defer dh.timing.log()
+	}
+	if err := dh.checkGitInstalled(); err != nil {
+		return err
+	}
+
+	switch dh.Mode {
+	case "restore":
+		if dh.Output == "" {
+			return fmt.Errorf("restore mode requires an input file path")
+		}
+		if dh.FromArchive != "" {
+			count, err := extractArchive(dh.FromArchive, dh.TargetDir)
+			if err != nil {
+				return fmt.Errorf("cannot extract archive: %v", err)
+			}
+			slog.Info("Extracted archive", "path", dh.FromArchive, "files", count, "target", dh.TargetDir)
+		}
+		return dh.RestoreFromFile(dh.resolveOutput())
+	case "adjust", "document", "xattr":
+		var previous []FileModTime
+		if dh.Mode == "document" && dh.Update {
+			var err error
+			if previous, err = dh.loadForUpdate(); err != nil {
+				return err
+			}
+		}
+
+		files, err := dh.scanRepo()
+		if errors.Is(err, errNoCommits) {
+			slog.Warn(err.Error() + ", nothing to do")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files, err = dh.processScanned(append(previous, files...))
+		if err != nil {
+			return err
+		}
+
+		if len(files) == 0 {
+			slog.Warn("no files found in git")
+			return nil
+		}
+
+		slog.Info("Found files", "count", len(files))
+
+		if dh.CountOnly {
+			printStats(files)
+			return nil
+		}
+		if dh.Mode == "adjust" {
+			return dh.AdjustFileTimes(files)
+		}
+		if dh.Mode == "xattr" {
+			return dh.WriteXattrs(files)
+		}
+		if dh.RelativeTo != "" {
+			if files, err = rebasePaths(files, dh.TargetDir, dh.RelativeTo); err != nil {
+				return err
+			}
+		}
+		return dh.GenerateDocument(files)
+	case "doctor":
+		return dh.Doctor()
+	case "prune":
+		return dh.Prune()
+	case "watch":
+		if err := dh.checkRepo(); err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return dh.Watch(ctx)
+	default:
+		return fmt.Errorf("unknown mode: %s (supported modes: adjust, document, restore, watch, doctor, prune, xattr)", dh.Mode)
 	}
 }
 
-func (dh *DocHelper) GetGitLastModified(filePath string) (time.Time, error) {
-	relPath, err := filepath.Rel(dh.TargetDir, filePath)
-	if err != nil {
-		return time.Time{}, err
+// validateOptions rejects option values that cannot be acted on.
+func (dh *DocHelper) validateOptions() error {
+	switch dh.DateKind {
+	case "", "committer", "author":
+	default:
+		return fmt.Errorf("invalid date kind: %s (supported: author, committer)", dh.DateKind)
 	}
 
-	cmd := exec.Command("git", "log", "-1", "--format=%ct", "--", relPath)
-	cmd.Dir = dh.TargetDir
-	output, err := cmd.Output()
-	if err != nil {
-		return time.Time{}, nil
+	switch dh.MinTimeAction {
+	case "", "clamp", "skip":
+	default:
+		return fmt.Errorf("invalid --min-time-action: %s (supported: clamp, skip)", dh.MinTimeAction)
 	}
 
-	timestampStr := strings.TrimSpace(string(output))
-	if timestampStr == "" {
-		return time.Time{}, nil
+	switch dh.BoundsAction {
+	case "", "reject", "clamp":
+	default:
+		return fmt.Errorf("invalid --bounds-action: %s (supported: reject, clamp)", dh.BoundsAction)
 	}
 
-	var timestamp int64
-	fmt.Sscanf(timestampStr, "%d", &timestamp)
-	return time.Unix(timestamp, 0), nil
-}
-
-func (dh *DocHelper) ScanDirectory() ([]FileModTime, error) {
-	var files []FileModTime
+	if err := dh.validateFilters(); err != nil {
+		return err
+	}
 
-	err := filepath.Walk(dh.TargetDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	if dh.NoGit {
+		if dh.Mode != "document" {
+			return fmt.Errorf("--no-git is only supported in document mode")
 		}
-
-		if info.IsDir() {
-			if info.Name() == ".git" {
-				return filepath.SkipDir
-			}
-			return nil
+		switch {
+		case dh.ChangedSince != "", dh.Update:
+			return fmt.Errorf("--no-git cannot be combined with --changed-since or --update")
+		case dh.ReportMissing, dh.IncludeMissing:
+			return fmt.Errorf("--no-git cannot be combined with --report-missing or --include-missing")
+		case dh.CachePath != "", dh.BatchSize > 0, dh.TaggedOnly, dh.FromTrailer != "":
+			return fmt.Errorf("--no-git cannot be combined with options that query git")
 		}
+	}
 
-		lastModified, err := dh.GetGitLastModified(path)
-		if err != nil {
-			fmt.Printf("Error: cannot get git modified time of %s: %v\n", path, err)
-			return nil
-		}
+	if dh.CommitTZ && dh.CachePath != "" {
+		return fmt.Errorf("--commit-tz cannot be combined with --cache, which stores times without a zone")
+	}
 
-		if lastModified.IsZero() {
-			return nil
-		}
+	if dh.SetBtime && dh.Mode != "adjust" {
+		return fmt.Errorf("--set-btime is only supported in adjust mode, which can ask git when each file was added")
+	}
 
-		relPath, _ := filepath.Rel(dh.TargetDir, path)
-		files = append(files, FileModTime{
-			Path:         relPath,
-			LastModified: lastModified,
-			UnixTime:     lastModified.Unix(),
-		})
+	if dh.Confirm && dh.Mode != "adjust" && dh.Mode != "restore" {
+		return fmt.Errorf("--confirm is only supported in adjust and restore modes")
+	}
 
-		return nil
-	})
+	if dh.Format != "" {
+		if format := formatByName(dh.Format); format == nil || format.generate == nil {
+			return fmt.Errorf("%w: unknown --format %s (see list-formats)", ErrUnsupportedFormat, dh.Format)
+		}
+		if dh.Mode != "document" {
+			return fmt.Errorf("--format is only supported in document mode")
+		}
+		if dh.Bucket != "" {
+			return fmt.Errorf("--format cannot be combined with --bucket")
+		}
+	}
+	if dh.CommitRange != "" {
+		if strings.HasPrefix(dh.CommitRange, "-") {
+			return fmt.Errorf("invalid --commit-range: %s", dh.CommitRange)
+		}
+		if dh.CachePath != "" {
+			return fmt.Errorf("--commit-range cannot be combined with --cache")
+		}
+		if dh.NoGit {
+			return fmt.Errorf("--no-git cannot be combined with --commit-range")
+		}
+	}
+	switch dh.RangeFallback {
+	case "", "skip", "history":
+	default:
+		return fmt.Errorf("invalid --commit-range-fallback: %s (supported: skip, history)", dh.RangeFallback)
+	}
 
-	return files, err
-}
+	if dh.StatePath != "" && dh.Mode != "adjust" && dh.Mode != "restore" {
+		return fmt.Errorf("--state is only supported in adjust and restore modes")
+	}
+	if dh.ErrorsOut != "" {
+		if dh.Mode != "adjust" && dh.Mode != "restore" {
+			return fmt.Errorf("--errors-out is only supported in adjust and restore modes")
+		}
+		if ext := strings.ToLower(filepath.Ext(dh.ErrorsOut)); ext != ".json" && ext != ".csv" {
+			return fmt.Errorf("--errors-out must be a .json or .csv file")
+		}
+	}
+	if dh.FromArchive != "" && dh.Mode != "restore" {
+		return fmt.Errorf("--from-archive is only supported in restore mode")
+	}
 
-func (dh *DocHelper) AdjustFileTimes(files []FileModTime) error {
-	adjustedCount := 0
-	errorCount := 0
+	switch dh.LineEnding {
+	case "", "lf", "crlf", "native":
+	default:
+		return fmt.Errorf("invalid --line-ending: %s (supported: lf, crlf, native)", dh.LineEnding)
+	}
 
-	for _, file := range files {
-		fullPath := filepath.Join(dh.TargetDir, file.Path)
+	switch dh.BinaryDetect {
+	case "", "heuristic":
+	case "git":
+		if dh.NoGit {
+			return fmt.Errorf("--binary-detect git cannot be combined with --no-git")
+		}
+	default:
+		return fmt.Errorf("invalid --binary-detect: %s (supported: heuristic, git)", dh.BinaryDetect)
+	}
 
-		err := os.Chtimes(fullPath, file.LastModified, file.LastModified)
-		if err != nil {
-			fmt.Printf("Error: cannot adjust time of %s: %v\n", file.Path, err)
-			errorCount++
-			continue
+	if dh.NoFollowChtimes {
+		if dh.Mode != "adjust" && dh.Mode != "restore" && dh.Mode != "watch" {
+			return fmt.Errorf("--no-follow-symlink-chtimes is only supported in adjust, restore and watch modes")
+		}
+		if !lchtimesSupported {
+			return errLchtimesUnsupported
+		}
+	}
+	if dh.Top < 0 {
+		return fmt.Errorf("--top must not be negative")
+	}
+	if dh.Top > 0 && (dh.Mode != "document" || dh.Update) {
+		return fmt.Errorf("--top is only supported in document mode, without --update")
+	}
+	if dh.WithUntracked {
+		if dh.Mode != "document" {
+			return fmt.Errorf("--include-untracked is only supported in document mode")
+		}
+		if dh.FailOnZero || dh.NoGit {
+			return fmt.Errorf("--include-untracked cannot be combined with --fail-on-zero or --no-git")
 		}
+	}
+	if dh.Append {
+		if err := dh.validateAppend(); err != nil {
+			return err
+		}
+	}
 
-		fmt.Printf("Adjusted: %s -> %s\n", file.Path, file.LastModified.Format("2006-01-02 15:04:05"))
-		adjustedCount++
+	switch dh.JSONShape {
+	case "", "array", "map":
+	default:
+		return fmt.Errorf("invalid --json-shape: %s (supported: array, map)", dh.JSONShape)
+	}
+	if dh.TouchEmptyDirs && dh.Mode != "adjust" && dh.Mode != "restore" {
+		return fmt.Errorf("--touch-empty-dirs is only supported in adjust and restore modes")
+	}
+	if dh.MaxAge > 0 && dh.Mode != "document" {
+		return fmt.Errorf("--max-age is only supported in document mode")
+	}
+	if dh.MaxWidth < 0 {
+		return fmt.Errorf("--max-width must not be negative")
 	}
 
-	fmt.Printf("\nCompleted: adjusted %d files, failed %d files\n", adjustedCount, errorCount)
-	return nil
-}
+	switch dh.Bucket {
+	case "", "week", "month", "quarter":
+	default:
+		return fmt.Errorf("invalid --bucket: %s (supported: week, month, quarter)", dh.Bucket)
+	}
+	if dh.Bucket != "" && dh.SplitByDir {
+		return fmt.Errorf("--bucket cannot be combined with --split-by-dir")
+	}
 
-func (dh *DocHelper) GenerateDocument(files []FileModTime) error {
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].LastModified.After(files[j].LastModified)
-	})
+	if dh.RelativeTo != "" && dh.Mode != "document" {
+		return fmt.Errorf("--relative-to is only supported in document mode")
+	}
 
-	outputPath := dh.Output
-	if outputPath == "" {
-		outputPath = filepath.Join(dh.TargetDir, "file_modification_times.json")
+	if dh.MaxFiles < 0 {
+		return fmt.Errorf("--max-files must not be negative")
 	}
 
-	// Display file information like adjust mode
-	for _, file := range files {
-		fmt.Printf("Documented: %s -> %s\n", file.Path, file.LastModified.Format("2006-01-02 15:04:05"))
+	if dh.BatchSize < 0 {
+		return fmt.Errorf("--batch-size must not be negative")
+	}
+	if dh.BatchSize > 0 && (dh.TaggedOnly || dh.FromTrailer != "") {
+		return fmt.Errorf("--batch-size cannot be combined with --tagged-only or --from-trailer")
+	}
+	if dh.SkipBulk < 0 {
+		return fmt.Errorf("--skip-bulk-commits must not be negative")
+	}
+	if dh.SkipBulk > 0 && (dh.TaggedOnly || dh.FromTrailer != "" || dh.BatchSize > 0) {
+		return fmt.Errorf("--skip-bulk-commits cannot be combined with --tagged-only, --from-trailer or --batch-size")
 	}
 
-	fmt.Println()
+	if dh.FilenameTZ != "" {
+		if _, err := time.LoadLocation(dh.FilenameTZ); err != nil {
+			return fmt.Errorf("invalid --filename-tz: %v", err)
+		}
+	}
 
-	ext := strings.ToLower(filepath.Ext(outputPath))
+	for _, spec := range dh.Aggregates {
+		if _, _, err := parseAggregate(spec); err != nil {
+			return err
+		}
+	}
 
-	switch ext {
-	case ".json":
-		return dh.generateJSONDocument(files, outputPath)
-	case ".csv":
-		return dh.generateCSVDocument(files, outputPath)
-	default:
-		return dh.generateJSONDocument(files, outputPath)
+	if dh.FromTrailer != "" && dh.TaggedOnly {
+		return fmt.Errorf("--from-trailer cannot be combined with --tagged-only")
 	}
-}
 
-func (dh *DocHelper) generateJSONDocument(files []FileModTime, outputPath string) error {
-	data, err := json.MarshalIndent(files, "", "  ")
-	if err != nil {
-		return fmt.Errorf("cannot serialize JSON: %v", err)
+	if len(dh.Outputs) > 0 && dh.Mode != "document" {
+		return fmt.Errorf("several outputs are only supported in document mode")
+	}
+	if len(dh.Outputs) > 0 && dh.SplitByDir {
+		return fmt.Errorf("--split-by-dir writes to a single output")
 	}
 
-	err = os.WriteFile(outputPath, data, 0644)
-	if err != nil {
-		return fmt.Errorf("cannot write file: %v", err)
+	if dh.CountOnly && dh.Mode != "document" {
+		return fmt.Errorf("--count-only is only supported in document mode")
+	}
+
+	if dh.Update && dh.ChangedSince != "" {
+		return fmt.Errorf("--update cannot be combined with --changed-since")
 	}
 
-	fmt.Printf("Generated JSON document: %s (total %d files)\n", outputPath, len(files))
+	if len(dh.Columns) > 0 {
+		hasPath, hasTime := false, false
+		for _, column := range dh.Columns {
+			hasPath = hasPath || column == "path"
+			hasTime = hasTime || column == "last_modified" || column == "unix_time"
+		}
+		if !hasPath || !hasTime {
+			return fmt.Errorf("--columns must include path and last_modified or unix_time")
+		}
+	}
 	return nil
 }
 
-func (dh *DocHelper) generateCSVDocument(files []FileModTime, outputPath string) error {
-	var builder strings.Builder
-	builder.WriteString("path,last_modified,unix_time\n")
+// scanRepo validates TargetDir and scans it for git times.
+func (dh *DocHelper) scanRepo() ([]FileModTime, error) {
+	if dh.NoGit {
+		if _, err := os.Stat(dh.TargetDir); os.IsNotExist(err) {
+			return nil, withExitCode(exitTargetDir, fmt.Errorf("target directory does not exist: %s", dh.TargetDir))
+		}
+		slog.Info("Scanning directory for file system times", "path", dh.TargetDir)
+	} else {
+		if err := dh.checkRepo(); err != nil {
+			return nil, err
+		}
 
-	for _, file := range files {
-		builder.WriteString(fmt.Sprintf("%s,%s,%d\n",
-			file.Path,
-			file.LastModified.Format("2006-01-02 15:04:05"),
-			file.UnixTime,
-		))
+		head, err := headCommit(dh.repo())
+		if err != nil {
+			return nil, err
+		}
+		dh.commit = head
+
+		slog.Info("Scanning directory for git times", "path", dh.TargetDir)
 	}
 
-	err := os.WriteFile(outputPath, []byte(builder.String()), 0644)
+	start := time.Now()
+	files, err := dh.ScanDirectory()
+	dh.timing.track(phaseScan, start)
+	if errors.Is(err, errInterrupted) {
+		return nil, withExitCode(exitInterrupted, err)
+	}
 	if err != nil {
-		return fmt.Errorf("cannot write file: %v", err)
+		return nil, fmt.Errorf("scan directory failed: %v", err)
 	}
-
-	fmt.Printf("Generated CSV document: %s (total %d files)\n", outputPath, len(files))
-	return nil
+	return files, nil
 }
 
-func (dh *DocHelper) generateMarkdownDocument(files []FileModTime, outputPath string) error {
-	var builder strings.Builder
-	builder.WriteString("# File modification times document\n\n")
-	builder.WriteString(fmt.Sprintf("Generated time: %s\n\n", time.Now().Format("2006-01-02 15:04:05")))
-	builder.WriteString(fmt.Sprintf("Target directory: %s\n\n", dh.TargetDir))
-	builder.WriteString(fmt.Sprintf("Total files: %d\n\n", len(files)))
-	builder.WriteString("## File list\n\n")
-	builder.WriteString("| File path | Last modified time | Unix time |\n")
-	builder.WriteString("|---------|-------------|-----------|\n")
-
-	for _, file := range files {
-		builder.WriteString(fmt.Sprintf("| %s | %s | %d |\n",
-			file.Path,
-			file.LastModified.Format("2006-01-02 15:04:05"),
-			file.UnixTime,
-		))
+// checkRepo verifies that TargetDir exists and is a git repository.
+func (dh *DocHelper) checkRepo() error {
+	if _, err := os.Stat(dh.TargetDir); os.IsNotExist(err) {
+		return withExitCode(exitTargetDir, fmt.Errorf("target directory does not exist: %s", dh.TargetDir))
 	}
 
-	err := os.WriteFile(outputPath, []byte(builder.String()), 0644)
-	if err != nil {
-		return fmt.Errorf("cannot write file: %v", err)
+	if _, err := dh.gitDirPath(); err != nil {
+		if dh.GitDir != "" {
+			return withExitCode(exitTargetDir, fmt.Errorf("git directory is not usable: %v", err))
+		}
+		return withExitCode(exitTargetDir, fmt.Errorf("%w: %s", ErrNotARepo, dh.TargetDir))
 	}
 
-	fmt.Printf("Generated Markdown document: %s (total %d files)\n", outputPath, len(files))
+	// A target below the repository root scans only that subtree; git
+	// listings print root-relative paths, so record where it sits.
+	if dh.GitDir == "" && dh.GitPrefix == "" {
+		if prefix, err := runGit(dh.repo(), "rev-parse", "--show-prefix"); err == nil && strings.TrimSpace(prefix) != "" {
+			dh.GitPrefix = strings.TrimSpace(prefix)
+			dh.git = nil
+			slog.Info("Target directory is inside a repository", "prefix", strings.TrimSuffix(dh.GitPrefix, "/"))
+		}
+	}
 	return nil
 }
 
-func (dh *DocHelper) ReadFromJSON(inputPath string) ([]FileModTime, error) {
-	data, err := os.ReadFile(inputPath)
-	if err != nil {
-		return nil, fmt.Errorf("cannot read file: %v", err)
+// gitDirPath returns the repository directory of TargetDir: GitDir when
+// set, otherwise .git, following a .git file to the directory it points
+// to as in worktrees and repositories cloned with --separate-git-dir. When
+// TargetDir has no .git it asks git for the enclosing repository.
+func (dh *DocHelper) gitDirPath() (string, error) {
+	if dh.GitDir != "" {
+		if _, err := os.Stat(dh.GitDir); err != nil {
+			return "", err
+		}
+		return dh.GitDir, nil
 	}
 
-	var files []FileModTime
-	err = json.Unmarshal(data, &files)
+	dotGit := filepath.Join(dh.TargetDir, ".git")
+	info, err := os.Stat(dotGit)
+	if os.IsNotExist(err) {
+		gitDir, err := runGit(dh.repo(), "rev-parse", "--absolute-git-dir")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(gitDir), nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("cannot parse JSON: %v", err)
+		return "", err
+	}
+	if info.IsDir() {
+		return dotGit, nil
 	}
 
-	// Make sure UnixTime field is correct
-	for i := range files {
-		if files[i].UnixTime == 0 && !files[i].LastModified.IsZero() {
-			files[i].UnixTime = files[i].LastModified.Unix()
-		}
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return "", err
 	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("%s is not a gitdir file", dotGit)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dh.TargetDir, target)
+	}
+	if _, err := os.Stat(target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
 
-	return files, nil
+func newFlagSet(dh *DocHelper) *flag.FlagSet {
+	fs := flag.NewFlagSet("DocHelper", flag.ContinueOnError)
+	fs.Usage = func() { usage(fs) }
+	fs.StringVar(&dh.BaseDir, "base-dir", "", "resolve a relative output/input file against this directory instead of the working directory")
+	fs.StringVar(&dh.RelativeTo, "relative-to", "", "in document mode, write paths relative to this directory instead of the scanned directory")
+	fs.StringVar(&dh.PathPrefix, "path-prefix", "", "prepend this string to every path in the generated document (e.g. /docs/)")
+	fs.StringVar(&dh.ChangedSince, "changed-since", "", "only process files changed between this git ref and HEAD")
+	fs.StringVar(&dh.CachePath, "cache", "", "cache git times in this file, keyed by path and blob hash, to speed up repeated runs")
+	fs.StringVar(&dh.GitDir, "git-dir", "", "repository directory to use instead of <target directory>/.git, as with git --git-dir")
+	fs.StringVar(&dh.GitPrefix, "git-prefix", "", "path of the target directory within the repository, prepended to paths passed to git (e.g. with --git-dir for a monorepo subtree)")
+	fs.StringVar(&dh.DateKind, "date-kind", "committer", "commit date to use: committer or author")
+	fs.StringVar(&dh.Format, "format", "", "in document mode, write this format regardless of the output extension (see list-formats); table prints to standard output when no output file is given")
+	fs.IntVar(&dh.MaxWidth, "max-width", 0, "in table output, truncate paths longer than this many characters with an ellipsis (0 = no limit)")
+	fs.StringVar(&dh.Bucket, "bucket", "", "in document mode, write file counts per week, month or quarter of last modification instead of a file list (JSON or CSV)")
+	fs.BoolVar(&dh.BucketFiles, "bucket-files", false, "with --bucket, also list the files in each period")
+	fs.BoolVar(&dh.GroupByDir, "group-by-dir", false, "in Markdown output, render one table per top-level directory")
+	fs.BoolVar(&dh.RelativeTime, "relative-time", false, "in Markdown output, add an age column such as \"3 days ago\"")
+	fs.BoolVar(&dh.SplitByDir, "split-by-dir", false, "write one document per top-level directory; the output is a directory or a file name template")
+	funcFlag(fs, "min-time", "earliest believable time (YYYY-MM-DD or RFC3339); earlier git times are clamped or skipped", func(value string) error {
+		t, err := parseDate(value)
+		dh.MinTime = t
+		return err
+	})
+	funcFlag(fs, "max-age", "in document mode, leave out files last modified longer ago than this (e.g. 2160h or 90d)", func(value string) error {
+		age, err := parseMaxAge(value)
+		dh.MaxAge = age
+		return err
+	})
+	fs.StringVar(&dh.MinTimeAction, "min-time-action", "clamp", "what to do with files older than --min-time: clamp or skip")
+	fs.BoolVar(&dh.CheckBounds, "check-bounds", false, "in restore mode, refuse times before the repository's first commit or in the future")
+	fs.StringVar(&dh.BoundsAction, "bounds-action", "reject", "what to do with restore times outside --check-bounds: reject or clamp")
+	fs.BoolVar(&dh.IncludeDirs, "include-dirs", false, "in document mode, also list directories dated by their newest file")
+	fs.StringVar(&dh.PostAdjustCmd, "post-adjust-cmd", "", "shell command to run after a successful adjust/restore, with DOCHELPER_ADJUSTED/SKIPPED/FAILED set")
+	fs.IntVar(&dh.MaxFiles, "max-files", 0, "fail when the scan finds more than N files, instead of running for hours on the wrong directory (0 means no limit)")
+	fs.IntVar(&dh.Limit, "limit", 0, "only scan or restore the first N files (0 means no limit)")
+	fs.BoolVar(&dh.ReportMissing, "report-missing", false, "in document mode, list files git tracks that are missing from the working tree")
+	fs.BoolVar(&dh.IncludeMissing, "include-missing", false, "like --report-missing, and add those files to the document with \"missing\": true")
+	fs.BoolVar(&dh.NoGit, "no-git", false, "in document mode, list file system mtimes without using git, for directories that are not repositories")
+	fs.BoolVar(&dh.CommitTZ, "commit-tz", false, "keep each commit's own time zone offset in documents instead of converting to the local zone")
+	fs.DurationVar(&dh.Timeout, "timeout", 30*time.Second, "time limit for fetching a restore document from an http(s) URL")
+	fs.BoolVar(&dh.Confirm, "confirm", false, "in adjust and restore, show how many files will change and ask before changing them")
+	fs.BoolVar(&dh.Yes, "yes", false, "answer yes to --confirm, for runs without a terminal")
+	fs.BoolVar(&dh.WithChecksum, "with-checksum", false, "record a SHA-256 checksum of each file's content in the document")
+	fs.BoolVar(&dh.VerifyChecksum, "verify-checksum", false, "in restore mode, skip files whose content no longer matches the recorded checksum")
+	fs.BoolVar(&dh.Preview, "preview", false, "in adjust and restore, print old -> new mtime for each file that would change, without changing anything")
+	fs.BoolVar(&dh.SetBtime, "set-btime", false, "in adjust mode, also set each file's creation time to the commit that added it (macOS, Windows)")
+	fs.BoolVar(&dh.KeepNewer, "keep-newer", false, "in adjust and restore, leave files whose mtime is already newer than the git time, such as uncommitted edits")
+	fs.Var(&dh.Include, "include", "only process paths matching this glob (** matches any directories), may be repeated")
+	fs.Var(&dh.Exclude, "exclude", "skip paths matching this glob, may be repeated")
+	fs.Var(&dh.Exts, "ext", "only process files with these extensions (e.g. md,html), may be repeated")
+	fs.Var(&dh.Aggregates, "aggregate", "add an entry target=glob dated by the newest matching file (** matches any directories), may be repeated")
+	fs.StringVar(&dh.FilenameTZ, "filename-tz", "UTC", "time zone for {date} and {time} in the output file name (UTC, Local or an IANA name)")
+	fs.StringVar(&dh.FilenameDateFormat, "filename-date-format", "2006-01-02", "Go time layout for {date} in the output file name")
+	fs.BoolVar(&dh.FailOnZero, "fail-on-zero", false, "fail, listing them, when any scanned file has no git history instead of silently leaving it out")
+	fs.BoolVar(&dh.CountOnly, "count-only", false, "in document mode, print file count, date range and a per-extension breakdown without writing a document")
+	fs.BoolVar(&dh.Update, "update", false, "in document mode, rescan only files changed since the commit recorded in the existing JSON document and keep other entries")
+	fs.StringVar(&dh.FromTrailer, "from-trailer", "", "use the date in this commit trailer (e.g. Published-Date) of the newest commit touching each file, falling back to the commit date")
+	fs.BoolVar(&dh.TaggedOnly, "tagged-only", false, "use the newest tagged commit touching each file, falling back to its newest commit")
+	fs.BoolVar(&dh.WithMode, "with-mode", false, "record permission bits in the document; restore applies recorded modes")
+	fs.BoolVar(&dh.PruneUntracked, "prune-untracked", false, "in prune mode, also remove entries for files git no longer tracks")
+	fs.BoolVar(&dh.JSONCompact, "json-compact", false, "write JSON documents without indentation")
+	funcFlag(fs, "columns", "comma-separated CSV columns in order (path, last_modified, unix_time, is_dir, missing, mode, checksum, source)", func(value string) error {
+		columns, err := parseColumns(value)
+		dh.Columns = columns
+		return err
+	})
+	funcFlag(fs, "header-names", "rename CSV headers as field=header pairs, e.g. path=file,unix_time=epoch", func(value string) error {
+		names, err := parseHeaderNames(value)
+		dh.HeaderNames = names
+		return err
+	})
+	fs.BoolVar(&dh.NoClobber, "no-clobber", false, "refuse to overwrite an existing output file")
+	fs.BoolVar(&dh.Backup, "backup", false, "rename an existing output file to <name>.bak before writing")
+	fs.BoolVar(&dh.FollowSymlinks, "follow-symlinks", false, "descend into symlinked directories and resolve symlinked files to their targets")
+	fs.BoolVar(&dh.DedupeByContent, "dedupe-by-content", false, "give files with identical content the newest time among them")
+	fs.BoolVar(&dh.TouchEmptyDirs, "touch-empty-dirs", false, "in adjust and restore modes, date directories without tracked files by the latest commit instead of leaving them alone")
+	fs.StringVar(&dh.CommitRange, "commit-range", "", "only consider commits in this revision range, such as v1.0..v2.0, for file times")
+	fs.StringVar(&dh.RangeFallback, "commit-range-fallback", "skip", "for files with no commit in --commit-range: skip them, or use their full history")
+	fs.StringVar(&dh.LineEnding, "line-ending", "lf", "line ending of written documents: lf, crlf, or native to the platform")
+	fs.BoolVar(&dh.TextOnly, "text-only", false, "leave binary files such as images and PDFs out of the scan")
+	fs.StringVar(&dh.BinaryDetect, "binary-detect", "heuristic", "how --text-only spots binary files: heuristic (a NUL byte near the start) or git (git's own detection, honoring .gitattributes)")
+	fs.BoolVar(&dh.Timing, "timing", false, "log how long scanning, git lookups and writing took")
+	fs.BoolVar(&dh.NoFollowChtimes, "no-follow-symlink-chtimes", false, "in adjust, restore and watch modes, set the times of symlinks themselves instead of their targets (Linux and macOS)")
+	fs.IntVar(&dh.Top, "top", 0, "in document mode, keep only the N most recently modified records (0 = all)")
+	fs.BoolVar(&dh.WithUntracked, "include-untracked", false, "in document mode, list files without git history by their file system mtime, marked with source \"filesystem\"")
+	fs.BoolVar(&dh.Append, "append", false, "in document mode, add records to an existing CSV document instead of replacing it")
+	fs.StringVar(&dh.JSONShape, "json-shape", "array", "layout of JSON documents: array (files listed with metadata) or map (an object keyed by path)")
+	fs.BoolVar(&dh.SkipSubmodules, "skip-submodules", false, "skip submodule directories listed in .gitmodules while scanning")
+	fs.BoolVar(&dh.DedupeHardlinks, "dedupe-hardlinks", false, "list hardlinked files once, under the first path found (no-op without inode support)")
+	fs.IntVar(&dh.Workers, "workers", 1, "number of file times to set concurrently in adjust and restore; scanning is always sequential")
+	fs.StringVar(&dh.StatePath, "state", "", "in adjust and restore, record finished paths in this file and skip them when run again, to resume an interrupted run")
+	fs.StringVar(&dh.ErrorsOut, "errors-out", "", "in adjust and restore, write every failed record and its error to this .json or .csv file, usable as restore input for a retry")
+	fs.StringVar(&dh.FromArchive, "from-archive", "", "in restore mode, first extract this .tar or .tar.gz archive into the target directory, creating it if needed")
+	fs.BoolVar(&dh.PrintConfig, "print-config", false, "print the resolved options as JSON, each with its source (flag, env or default), and exit without running")
+	fs.IntVar(&dh.SkipBulk, "skip-bulk-commits", 0, "ignore commits that touched more than N files, such as repository-wide reformats, when dating files (0 disables)")
+	fs.IntVar(&dh.BatchSize, "batch-size", 0, "look up git times for this many files per git log call instead of one call per file (0 disables batching)")
+	fs.IntVar(&dh.GitRetries, "git-retries", 3, "attempts per file when git fails transiently (e.g. resource temporarily unavailable)")
+	fs.Var(&dh.Outputs, "output", "document to write, may be repeated to write several formats from one scan (the first one replaces the positional output file if that is omitted)")
+	fs.Var(&dh.Dirs, "dir", "target directory, may be repeated to process several directories (positional arguments are then <mode> [output/input file])")
+	fs.BoolVar(&dh.Merge, "merge", false, "with several --dir, write one document with paths relative to their common parent")
+	fs.BoolVar(&dh.Strict, "strict", false, "with several --dir, stop at the first directory that fails; reject JSON documents whose unix_time and last_modified disagree")
+	fs.StringVar(&dh.LogLevel, "log-level", "info", "minimum level to log: debug, info, warn or error")
+	fs.StringVar(&dh.LogFormat, "log-format", "text", "log output format: text or json")
+	return fs
 }
 
-func (dh *DocHelper) ReadFromCSV(inputPath string) ([]FileModTime, error) {
-	file, err := os.Open(inputPath)
+// parseDate parses a date given on the command line, as YYYY-MM-DD,
+// YYYY-MM-DD HH:MM:SS (both in local time) or RFC3339.
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.Parse(time.RFC3339, value)
 	if err != nil {
-		return nil, fmt.Errorf("cannot open file: %v", err)
+		return time.Time{}, fmt.Errorf("cannot parse date %q (use YYYY-MM-DD or RFC3339)", value)
 	}
-	defer file.Close()
+	return t, nil
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, fmt.Errorf("cannot read CSV: %v", err)
+// parseArgs parses flags from args, allowing them to appear before, between
+// or after the positional arguments, and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
+}
 
-	if len(records) < 2 {
-		return nil, fmt.Errorf("CSV file is empty or missing header")
+// resolveArgs takes the target directory, mode and output file from the
+// positional arguments args, filling in Dirs unless --dir was given. The
+// mode may come from the environment instead, looked up with lookup, and
+// the output from the first --output. It reports false when the directory
+// or the mode is missing.
+func resolveArgs(dh *DocHelper, args []string, lookup func(string) (string, bool)) (mode, output, modeSource string, ok bool) {
+	// Without --dir the first positional argument is the directory.
+	if len(dh.Dirs) == 0 && len(args) > 0 {
+		dh.Dirs = stringList{args[0]}
+		args = args[1:]
 	}
 
-	var files []FileModTime
-	for i := 1; i < len(records); i++ {
-		record := records[i]
-		if len(record) < 3 {
-			continue
+	// The mode may come from the environment like the options.
+	modeSource = "argument"
+	if len(args) < 1 {
+		if mode, ok := lookup(envName("mode")); ok {
+			args = []string{mode}
+			modeSource = "env"
 		}
+	}
 
-		path := record[0]
-		lastModifiedStr := record[1]
-		unixTimeStr := record[2]
+	if len(dh.Dirs) == 0 || len(args) < 1 {
+		return "", "", "", false
+	}
 
-		unixTime, err := strconv.ParseInt(unixTimeStr, 10, 64)
-		if err != nil {
-			lastModified, err := time.Parse("2006-01-02 15:04:05", lastModifiedStr)
-			if err != nil {
-				lastModified, err = time.Parse(time.RFC3339, lastModifiedStr)
-				if err != nil {
-					fmt.Printf("Warning: cannot parse time for %s: %v\n", path, err)
-					continue
-				}
-			}
-			unixTime = lastModified.Unix()
-			files = append(files, FileModTime{
-				Path:         path,
-				LastModified: lastModified,
-				UnixTime:     unixTime,
-			})
-		} else {
-			lastModified := time.Unix(unixTime, 0)
-			files = append(files, FileModTime{
-				Path:         path,
-				LastModified: lastModified,
-				UnixTime:     unixTime,
-			})
-		}
+	mode = args[0]
+	if len(args) > 1 {
+		output = args[1]
+	} else if len(dh.Outputs) > 0 {
+		output = dh.Outputs[0]
+		dh.Outputs = dh.Outputs[1:]
 	}
+	return mode, output, modeSource, true
+}
 
-	return files, nil
+func usage(fs *flag.FlagSet) {
+	fmt.Println("Usage:")
+	fmt.Println("  DocHelper [options] <directory path> <mode> [output/input file]")
+	fmt.Println("  DocHelper [options] --dir <directory path> [--dir ...] <mode> [output/input file]")
+	fmt.Println("  DocHelper completion <bash|zsh|fish|powershell>")
+	fmt.Println("  DocHelper list-formats")
+	fmt.Println()
+	fmt.Println("Modes:")
+	fmt.Println("  adjust    - adjust file system times based on git last modified time")
+	fmt.Println("  document  - generate file modification times document")
+	fmt.Println("  restore   - restore file times from a JSON or CSV file, or a directory of them")
+	fmt.Println("  watch     - keep running and re-adjust files when they change or new commits touch them")
+	fmt.Println("  doctor    - check that git and the target repository are usable")
+	fmt.Println("  prune     - remove entries for deleted files from a JSON or CSV document in place")
+	fmt.Println("  xattr     - store git times and commits in extended attributes instead of mtimes (Linux, macOS)")
+	fmt.Println()
+	fmt.Println("Options:")
+	fs.SetOutput(os.Stdout)
+	fs.PrintDefaults()
+	fmt.Println()
+	fmt.Println("Environment:")
+	fmt.Println("  every option can also be set as DOCHELPER_<NAME>, e.g. DOCHELPER_LOG_LEVEL=debug,")
+	fmt.Println("  and the mode as DOCHELPER_MODE; options given on the command line take precedence")
+	fmt.Println()
+	fmt.Println("Output file resolution:")
+	fmt.Println("  no file given    -> <directory path>/file_modification_times.json")
+	fmt.Println("  absolute path    -> used as is")
+	fmt.Println("  relative path    -> relative to --base-dir, or to the working directory")
+	fmt.Println("  {date}, {time}   -> replaced with the run date and time (see --filename-tz)")
+	fmt.Println()
+	fmt.Println("Exit codes:")
+	fmt.Println("  0    success")
+	fmt.Println("  1    usage error or other failure")
+	fmt.Println("  2    target directory missing or not a git repository")
+	fmt.Println("  3    some files could not be adjusted")
+	fmt.Println("  4    output document could not be written")
+	fmt.Println("  130  interrupted during adjust or restore")
+	fmt.Println()
+	fmt.Println("Examples:")
+	fmt.Println("  DocHelper . document file_times.json")
+	fmt.Println("  DocHelper . document file_times.csv")
+	fmt.Println("  DocHelper --group-by-dir . document file_times.md")
+	fmt.Println("  DocHelper . adjust")
+	fmt.Println("  DocHelper . watch")
+	fmt.Println("  DocHelper . doctor")
+	fmt.Println("  DocHelper --follow-symlinks . document file_times.json")
+	fmt.Println("  DocHelper --changed-since v1.2.0 . adjust")
+	fmt.Println("  DocHelper --dir docs-a --dir docs-b --merge document all_times.json")
+	fmt.Println("  DocHelper . restore file_times.json")
+	fmt.Println("  DocHelper . restore file_times.csv")
+	fmt.Println("  DocHelper . prune file_times.json")
 }
 
-func (dh *DocHelper) RestoreFromFile(inputPath string) error {
-	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
-		return fmt.Errorf("input file does not exist: %s", inputPath)
+// interruptContext returns a context cancelled on the first SIGINT, so an
+// adjust or restore stops after the files in progress and still saves its
+// state and errors files. A second SIGINT exits at once.
+func interruptContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx
+}
+
+func main() {
+	helper := NewDocHelper("", "", "")
+	fs := newFlagSet(helper)
+
+	args, err := parseArgs(fs, os.Args[1:])
+	if err != nil {
+		os.Exit(exitUsage)
+	}
+	fromFlags := setFlags(fs)
+	if err := applyEnv(fs, os.LookupEnv); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
 
-	if _, err := os.Stat(dh.TargetDir); os.IsNotExist(err) {
-		return fmt.Errorf("target directory does not exist: %s", dh.TargetDir)
+	logger, err := newLogger(os.Stdout, helper.LogLevel, helper.LogFormat)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
+	slog.SetDefault(logger)
 
-	ext := strings.ToLower(filepath.Ext(inputPath))
-	var files []FileModTime
-	var err error
+	if len(args) == 1 && args[0] == "list-formats" {
+		if err := writeFormats(os.Stdout); err != nil {
+			os.Exit(exitUsage)
+		}
+		return
+	}
 
-	fmt.Printf("Reading from file: %s\n", inputPath)
-	switch ext {
-	case ".json":
-		files, err = dh.ReadFromJSON(inputPath)
-	case ".csv":
-		files, err = dh.ReadFromCSV(inputPath)
-	default:
-		return fmt.Errorf("unsupported file format: %s (supported: .json, .csv)", ext)
+	if len(args) == 2 && args[0] == "completion" && slices.Contains(completionShells, args[1]) {
+		if err := writeCompletion(os.Stdout, fs, args[1]); err != nil {
+			slog.Error(err.Error())
+			os.Exit(exitUsage)
+		}
+		return
 	}
 
-	if err != nil {
-		return fmt.Errorf("cannot read file: %v", err)
+	mode, output, modeSource, ok := resolveArgs(helper, args, os.LookupEnv)
+	if !ok {
+		fs.Usage()
+		os.Exit(exitUsage)
 	}
 
-	if len(files) == 0 {
-		return fmt.Errorf("no file data found in input file")
+	for i, dir := range helper.Dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			slog.Error("cannot parse directory path", "error", err)
+			os.Exit(exitUsage)
+		}
+		helper.Dirs[i] = absDir
 	}
 
-	fmt.Printf("Loaded %d files from %s\n\n", len(files), inputPath)
-	return dh.AdjustFileTimes(files)
-}
+	if helper.CachePath != "" {
+		if absCache, err := filepath.Abs(helper.CachePath); err == nil {
+			helper.CachePath = absCache
+		}
+	}
 
-func (dh *DocHelper) Run() error {
-	switch dh.Mode {
-	case "restore":
-		if dh.Output == "" {
-			return fmt.Errorf("restore mode requires an input file path")
+	if helper.StatePath != "" {
+		if absState, err := filepath.Abs(helper.StatePath); err == nil {
+			helper.StatePath = absState
 		}
-		return dh.RestoreFromFile(dh.Output)
-	case "adjust", "document":
-		if _, err := os.Stat(dh.TargetDir); os.IsNotExist(err) {
-			return fmt.Errorf("target directory does not exist: %s", dh.TargetDir)
+	}
+
+	if helper.ErrorsOut != "" {
+		if absErrors, err := filepath.Abs(helper.ErrorsOut); err == nil {
+			helper.ErrorsOut = absErrors
 		}
+	}
 
-		gitDir := filepath.Join(dh.TargetDir, ".git")
-		if _, err := os.Stat(gitDir); os.IsNotExist(err) {
-			return fmt.Errorf("target directory is not a git repository: %s", dh.TargetDir)
+	if helper.FromArchive != "" {
+		if absArchive, err := filepath.Abs(helper.FromArchive); err == nil {
+			helper.FromArchive = absArchive
 		}
+	}
 
-		fmt.Printf("Scanning directory: %s\n", dh.TargetDir)
-		fmt.Println("Getting file last modified time from git...")
+	if helper.RelativeTo != "" {
+		if absRoot, err := filepath.Abs(helper.RelativeTo); err == nil {
+			helper.RelativeTo = absRoot
+		}
+	}
 
-		files, err := dh.ScanDirectory()
-		if err != nil {
-			return fmt.Errorf("scan directory failed: %v", err)
+	if helper.GitDir != "" {
+		if absGitDir, err := filepath.Abs(helper.GitDir); err == nil {
+			helper.GitDir = absGitDir
 		}
+	}
 
-		if len(files) == 0 {
-			fmt.Println("Warning: no files found in git")
-			return nil
+	if helper.BaseDir != "" {
+		absBase, err := filepath.Abs(helper.BaseDir)
+		if err != nil {
+			slog.Error("cannot parse base directory path", "error", err)
+			os.Exit(exitUsage)
 		}
+		helper.BaseDir = absBase
+	}
 
-		fmt.Printf("Found %d files\n\n", len(files))
+	helper.TargetDir = helper.Dirs[0]
+	helper.Output = output
+	helper.Mode = mode
 
-		if dh.Mode == "adjust" {
-			return dh.AdjustFileTimes(files)
+	if helper.PrintConfig {
+		if err := writeConfig(os.Stdout, fs, fromFlags, helper, modeSource); err != nil {
+			slog.Error(err.Error())
+			os.Exit(exitUsage)
 		}
-		return dh.GenerateDocument(files)
-	default:
-		return fmt.Errorf("unknown mode: %s (supported modes: adjust, document, restore)", dh.Mode)
+		return
 	}
-}
 
-func main() {
-	if len(os.Args) < 3 {
-		fmt.Println("Usage:")
-		fmt.Println("  DocHelper <directory path> <mode> [output/input file]")
-		fmt.Println()
-		fmt.Println("Modes:")
-		fmt.Println("  adjust    - adjust file system times based on git last modified time")
-		fmt.Println("  document  - generate file modification times document")
-		fmt.Println("  restore   - restore file times from JSON or CSV file")
-		fmt.Println()
-		fmt.Println("Examples:")
-		fmt.Println("  DocHelper . document file_times.json")
-		fmt.Println("  DocHelper . document file_times.csv")
-		fmt.Println("  DocHelper . adjust")
-		fmt.Println("  DocHelper . restore file_times.json")
-		fmt.Println("  DocHelper . restore file_times.csv")
-		os.Exit(1)
-	}
-
-	targetDir := os.Args[1]
-	mode := os.Args[2]
-	output := ""
-	if len(os.Args) > 3 {
-		output = os.Args[3]
-	}
-
-	absDir, err := filepath.Abs(targetDir)
-	if err != nil {
-		fmt.Printf("Error: cannot parse directory path: %v\n", err)
-		os.Exit(1)
+	if mode == "adjust" || mode == "restore" {
+		helper.progress = &adjustProgress{}
+		helper.ctx = interruptContext()
 	}
 
-	if mode == "restore" && output != "" {
-		absOutput, err := filepath.Abs(output)
-		if err == nil {
-			output = absOutput
-		}
+	run := helper.Run
+	if len(helper.Dirs) > 1 {
+		run = helper.RunDirs
 	}
-
-	helper := NewDocHelper(absDir, output, mode)
-	if err := helper.Run(); err != nil {
-		fmt.Printf("Error: %v\n", err)
-		os.Exit(1)
+	if err := run(); err != nil {
+		if errors.Is(err, errInterrupted) {
+			slog.Error("Interrupted", "adjusted", helper.progress.adjusted.Load(), "skipped", helper.progress.skipped.Load(), "failed", helper.progress.failed.Load())
+		} else {
+			slog.Error(err.Error())
+		}
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,1625 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeGit serves last-modified times from a map keyed by slash-separated
+// relative path. Paths missing from the map have no history.
+type fakeGit map[string]time.Time
+
+func (f fakeGit) LastModified(rel string) (time.Time, string, error) {
+	return f[filepath.ToSlash(rel)], "", nil
+}
+
+func writeFiles(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for _, p := range paths {
+		full := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestHelper(dir string, git fakeGit) *DocHelper {
+	dh := NewDocHelper(dir, "", "document")
+	dh.git = git
+	return dh
+}
+
+func TestParseGitTimestamp(t *testing.T) {
+	got, err := parseGitTimestamp("1705315800\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Unix() != 1705315800 {
+		t.Errorf("got %d, want 1705315800", got.Unix())
+	}
+
+	got, err = parseGitTimestamp("  \n")
+	if err != nil || !got.IsZero() {
+		t.Errorf("empty output: got %v, %v; want zero time", got, err)
+	}
+
+	if _, err := parseGitTimestamp("not-a-number"); err == nil {
+		t.Error("expected error for malformed timestamp")
+	}
+}
+
+func TestScanDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "docs/b.md", "untracked.txt", ".git/HEAD")
+
+	t1 := time.Unix(1700000000, 0)
+	t2 := time.Unix(1710000000, 0)
+	dh := newTestHelper(dir, fakeGit{"a.md": t1, "docs/b.md": t2, ".git/HEAD": t2})
+
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2: %+v", len(files), files)
+	}
+	if files[0].Path != "a.md" || files[0].UnixTime != t1.Unix() {
+		t.Errorf("unexpected first entry: %+v", files[0])
+	}
+	if files[1].Path != filepath.FromSlash("docs/b.md") || files[1].UnixTime != t2.Unix() {
+		t.Errorf("unexpected second entry: %+v", files[1])
+	}
+}
+
+func sampleFiles() []FileModTime {
+	t1 := time.Unix(1700000000, 0)
+	t2 := time.Unix(1710000000, 0)
+	return []FileModTime{
+		{Path: "a.md", LastModified: t1, UnixTime: t1.Unix()},
+		{Path: "docs/b.md", LastModified: t2, UnixTime: t2.Unix()},
+	}
+}
+
+func assertSameFiles(t *testing.T, got, want []FileModTime) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d files, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Path != want[i].Path || got[i].UnixTime != want[i].UnixTime ||
+			!got[i].LastModified.Equal(want[i].LastModified) {
+			t.Errorf("entry %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dh := newTestHelper(dir, nil)
+	out := filepath.Join(dir, "times.json")
+
+	want := sampleFiles()
+	if err := dh.generateJSONDocument(want, out); err != nil {
+		t.Fatal(err)
+	}
+
+	got, metadata, err := dh.ReadFromJSON(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, got, want)
+
+	if metadata == nil {
+		t.Fatal("expected metadata in generated document")
+	}
+	if metadata.FileCount != len(want) || metadata.TargetDir != dir || metadata.ManifestHash != manifestHash(want) {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+}
+
+func TestReadFromJSONLegacyArray(t *testing.T) {
+	dir := t.TempDir()
+	dh := newTestHelper(dir, nil)
+	in := filepath.Join(dir, "legacy.json")
+
+	legacy := `[{"path": "a.md", "last_modified": "2023-11-14T22:13:20Z", "unix_time": 0}]`
+	if err := os.WriteFile(in, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, metadata, err := dh.ReadFromJSON(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata != nil {
+		t.Errorf("expected no metadata for a bare array, got %+v", metadata)
+	}
+	if len(got) != 1 || got[0].Path != "a.md" || got[0].UnixTime != 1700000000 {
+		t.Errorf("unexpected files: %+v", got)
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dh := newTestHelper(dir, nil)
+	out := filepath.Join(dir, "times.csv")
+
+	want := sampleFiles()
+	if err := dh.generateCSVDocument(want, out); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := dh.ReadFromCSV(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, got, want)
+}
+
+func TestAdjustFileTimes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "docs/b.md")
+	dh := newTestHelper(dir, nil)
+
+	files := sampleFiles()
+	if err := dh.AdjustFileTimes(files); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(f.LastModified) {
+			t.Errorf("%s: mtime %v, want %v", f.Path, info.ModTime(), f.LastModified)
+		}
+	}
+}
+
+func TestNoFollowSymlinkChtimes(t *testing.T) {
+	if !lchtimesSupported {
+		t.Skip("symlink times cannot be set on this platform")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, "target.md")
+	if err := os.Symlink("target.md", filepath.Join(dir, "link.md")); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(filepath.Join(dir, "target.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Unix(1700000000, 0)
+	dh := newTestHelper(dir, nil)
+	dh.NoFollowChtimes = true
+	if err := dh.AdjustFileTimes([]FileModTime{{Path: "link.md", LastModified: at, UnixTime: at.Unix()}}); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := os.Lstat(filepath.Join(dir, "link.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !link.ModTime().Equal(at) {
+		t.Errorf("link mtime %v, want %v", link.ModTime(), at)
+	}
+	after, err := os.Stat(filepath.Join(dir, "target.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("target mtime changed from %v to %v", before.ModTime(), after.ModTime())
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	dir := t.TempDir()
+
+	dh := NewDocHelper(filepath.Join(dir, "missing"), "", "document")
+	if code := exitCode(dh.Run()); code != exitTargetDir {
+		t.Errorf("missing dir: exit code %d, want %d", code, exitTargetDir)
+	}
+
+	dh = NewDocHelper(dir, "", "document")
+	if code := exitCode(dh.Run()); code != exitTargetDir {
+		t.Errorf("not a repo: exit code %d, want %d", code, exitTargetDir)
+	}
+
+	dh = NewDocHelper(dir, "", "bogus")
+	if code := exitCode(dh.Run()); code != exitUsage {
+		t.Errorf("unknown mode: exit code %d, want %d", code, exitUsage)
+	}
+}
+
+func TestGitNotInstalled(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", t.TempDir())
+
+	dh := NewDocHelper(dir, "", "document")
+	if err := dh.Run(); !errors.Is(err, errGitNotFound) {
+		t.Errorf("document without git: got %v, want %v", err, errGitNotFound)
+	}
+
+	dh = NewDocHelper(dir, "", "document")
+	dh.NoGit = true
+	if err := dh.Run(); errors.Is(err, errGitNotFound) {
+		t.Errorf("--no-git needs no git executable, got %v", err)
+	}
+
+	dh = NewDocHelper(dir, filepath.Join(dir, "times.json"), "restore")
+	if err := dh.Run(); errors.Is(err, errGitNotFound) {
+		t.Errorf("restore needs no git executable, got %v", err)
+	}
+
+	dh = NewDocHelper(dir, filepath.Join(dir, "times.json"), "prune")
+	if err := dh.Run(); errors.Is(err, errGitNotFound) {
+		t.Errorf("prune needs no git executable, got %v", err)
+	}
+
+	dh = NewDocHelper(dir, "", "doctor")
+	if err := dh.Run(); err == nil || errors.Is(err, errGitNotFound) {
+		t.Errorf("doctor should report the missing git in its checklist, got %v", err)
+	}
+}
+
+func TestAdjustFileTimesPartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	// A plain file named docs makes docs/b.md fail with "not a directory".
+	writeFiles(t, dir, "a.md", "docs")
+	dh := newTestHelper(dir, nil)
+
+	err := dh.AdjustFileTimes(sampleFiles())
+	if err == nil {
+		t.Fatal("expected an error when a file cannot be adjusted")
+	}
+	if code := exitCode(err); code != exitPartial {
+		t.Errorf("exit code %d, want %d", code, exitPartial)
+	}
+	var fileErrs *FileErrors
+	if !errors.As(err, &fileErrs) {
+		t.Fatalf("error %v is not a *FileErrors", err)
+	}
+	if errs := fileErrs.Errors(); len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), filepath.Join("docs", "b.md")+": ") {
+		t.Errorf("per-file errors = %v, want one for docs/b.md", errs)
+	}
+	if !errors.Is(err, syscall.ENOTDIR) && runtime.GOOS != "windows" {
+		t.Errorf("errors.Is(%v, ENOTDIR) = false, want the cause reachable", err)
+	}
+
+	info, statErr := os.Stat(filepath.Join(dir, "a.md"))
+	if statErr != nil {
+		t.Fatal(statErr)
+	}
+	if !info.ModTime().Equal(sampleFiles()[0].LastModified) {
+		t.Errorf("a.md was not adjusted despite the other failure")
+	}
+}
+
+func TestResolveOutput(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "src")
+	base := filepath.Join(t.TempDir(), "build")
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		output, baseDir, want string
+	}{
+		{"", "", filepath.Join(target, "file_modification_times.json")},
+		{"", base, filepath.Join(target, "file_modification_times.json")},
+		{"times.json", "", filepath.Join(wd, "times.json")},
+		{"meta/times.json", base, filepath.Join(base, "meta", "times.json")},
+		{filepath.Join(base, "abs.json"), target, filepath.Join(base, "abs.json")},
+	}
+
+	for _, tt := range tests {
+		dh := NewDocHelper(target, filepath.FromSlash(tt.output), "document")
+		dh.BaseDir = tt.baseDir
+		if got := dh.resolveOutput(); got != tt.want {
+			t.Errorf("output %q, base %q: got %q, want %q", tt.output, tt.baseDir, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateDocumentOrdersTies(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Unix(1700000000, 0)
+	older := time.Unix(1600000000, 0)
+	files := []FileModTime{
+		{Path: "c.md", LastModified: at, UnixTime: at.Unix()},
+		{Path: "old.md", LastModified: older, UnixTime: older.Unix()},
+		{Path: "a.md", LastModified: at, UnixTime: at.Unix()},
+		{Path: "b.md", LastModified: at, UnixTime: at.Unix()},
+	}
+
+	dh := NewDocHelper(dir, filepath.Join(dir, "times.csv"), "document")
+	if err := dh.GenerateDocument(files); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dh.ReadFromCSV(filepath.Join(dir, "times.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, file := range got {
+		paths = append(paths, file.Path)
+	}
+	if want := "a.md b.md c.md old.md"; strings.Join(paths, " ") != want {
+		t.Errorf("order = %v, want %s", paths, want)
+	}
+}
+
+func TestTop(t *testing.T) {
+	dir := t.TempDir()
+	var files []FileModTime
+	for i, name := range []string{"a.md", "b.md", "c.md", "d.md"} {
+		at := time.Unix(1700000000+int64(i), 0)
+		files = append(files, FileModTime{Path: name, LastModified: at, UnixTime: at.Unix()})
+	}
+
+	dh := NewDocHelper(dir, filepath.Join(dir, "times.csv"), "document")
+	dh.Top = 2
+	if err := dh.GenerateDocument(files); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dh.ReadFromCSV(filepath.Join(dir, "times.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Path != "d.md" || got[1].Path != "c.md" {
+		t.Errorf("got %+v, want d.md and c.md", got)
+	}
+}
+
+func TestPrefixPaths(t *testing.T) {
+	dh := newTestHelper(t.TempDir(), nil)
+	files := sampleFiles()
+
+	if got := dh.prefixPaths(files); &got[0] != &files[0] {
+		t.Error("expected files to be returned unchanged without a prefix")
+	}
+
+	dh.PathPrefix = "/site/"
+	got := dh.prefixPaths(files)
+	if got[0].Path != "/site/a.md" || got[1].Path != "/site/docs/b.md" {
+		t.Errorf("unexpected prefixed paths: %q, %q", got[0].Path, got[1].Path)
+	}
+	if files[0].Path != "a.md" {
+		t.Errorf("original slice was modified: %q", files[0].Path)
+	}
+}
+
+func TestGzipRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	dh := newTestHelper(dir, nil)
+	want := sampleFiles()
+
+	jsonOut := filepath.Join(dir, "times.json.gz")
+	if err := dh.generateJSONDocument(want, jsonOut); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := dh.ReadFromJSON(jsonOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, got, want)
+
+	csvOut := filepath.Join(dir, "times.CSV.gz")
+	if err := dh.generateCSVDocument(want, csvOut); err != nil {
+		t.Fatal(err)
+	}
+	got, err = dh.ReadFromCSV(csvOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, got, want)
+
+	if ext := documentExt(csvOut); ext != ".csv" {
+		t.Errorf("documentExt(%q) = %q, want .csv", csvOut, ext)
+	}
+}
+
+func TestAdjustFileTimesWorkers(t *testing.T) {
+	dir := t.TempDir()
+	var files []FileModTime
+	for i := 0; i < 50; i++ {
+		path := filepath.Join("docs", strconv.Itoa(i)+".md")
+		writeFiles(t, dir, filepath.ToSlash(path))
+		modTime := time.Unix(int64(1700000000+i*60), 0)
+		files = append(files, FileModTime{Path: path, LastModified: modTime, UnixTime: modTime.Unix()})
+	}
+	files = append(files, FileModTime{Path: filepath.Join("docs", "0.md", "child.md"), LastModified: time.Unix(1700000000, 0)})
+
+	for _, workers := range []int{8, 1} {
+		dh := newTestHelper(dir, nil)
+		dh.Workers = workers
+		dh.progress = &adjustProgress{}
+		err := dh.AdjustFileTimes(files)
+		if code := exitCode(err); err == nil || code != exitPartial {
+			t.Fatalf("expected partial failure, got %v (exit code %d)", err, code)
+		}
+		if !strings.Contains(err.Error(), "1 of 51") {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if adjusted, failed := dh.progress.adjusted.Load(), dh.progress.failed.Load(); adjusted != 50 || failed != 1 {
+			t.Errorf("workers %d: adjusted %d, failed %d; want 50 and 1", workers, adjusted, failed)
+		}
+
+		for _, f := range files[:50] {
+			info, err := os.Stat(filepath.Join(dir, f.Path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.ModTime().Equal(f.LastModified) {
+				t.Errorf("%s: mtime %v, want %v", f.Path, info.ModTime(), f.LastModified)
+			}
+		}
+	}
+}
+
+func TestProgressFunc(t *testing.T) {
+	dir := t.TempDir()
+	var files []FileModTime
+	for i := 0; i < 20; i++ {
+		path := filepath.Join("docs", strconv.Itoa(i)+".md")
+		writeFiles(t, dir, filepath.ToSlash(path))
+		modTime := time.Unix(int64(1700000000+i*60), 0)
+		files = append(files, FileModTime{Path: path, LastModified: modTime, UnixTime: modTime.Unix()})
+	}
+
+	dh := newTestHelper(dir, nil)
+	dh.Workers = 8
+	// Appending without a lock is safe only because calls never overlap;
+	// go test -race checks that.
+	var dones []int
+	seen := make(map[string]bool)
+	dh.ProgressFunc = func(done, total int, current string) {
+		if total != len(files) {
+			t.Errorf("total = %d, want %d", total, len(files))
+		}
+		dones = append(dones, done)
+		seen[current] = true
+	}
+	if err := dh.AdjustFileTimes(files); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, done := range dones {
+		if done != i+1 {
+			t.Fatalf("done values %v, want 1 to %d in order", dones, len(files))
+		}
+	}
+	for _, f := range files {
+		if !seen[filepath.ToSlash(f.Path)] {
+			t.Errorf("no progress reported for %s", f.Path)
+		}
+	}
+	if len(dones) != len(files) {
+		t.Errorf("%d progress calls, want %d", len(dones), len(files))
+	}
+}
+
+func TestAdjustFileTimesInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	var files []FileModTime
+	for i := 0; i < 5; i++ {
+		path := strconv.Itoa(i) + ".md"
+		writeFiles(t, dir, path)
+		files = append(files, FileModTime{Path: path, LastModified: time.Unix(1700000000, 0), UnixTime: 1700000000})
+	}
+	state := filepath.Join(t.TempDir(), "restore.state")
+	errorsOut := filepath.Join(t.TempDir(), "failed.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dh := newTestHelper(dir, nil)
+	dh.ctx = ctx
+	dh.StatePath = state
+	dh.ErrorsOut = errorsOut
+	// Ctrl+C arrives while the second file is being adjusted.
+	dh.ProgressFunc = func(done, total int, current string) {
+		if done == 2 {
+			cancel()
+		}
+	}
+
+	err := dh.AdjustFileTimes(files)
+	if !errors.Is(err, errInterrupted) || exitCode(err) != exitInterrupted {
+		t.Fatalf("got %v (exit code %d), want an interrupt", err, exitCode(err))
+	}
+
+	// The state file is kept with the finished paths, for a resume.
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0.md\n1.md\n" {
+		t.Errorf("state file %q, want the two finished paths", data)
+	}
+	// The errors file lists the records never attempted, for a retry.
+	remaining, err := dh.loadDocument(errorsOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 3 || remaining[0].Path != "2.md" {
+		t.Errorf("errors file lists %+v, want 2.md to 4.md", remaining)
+	}
+}
+
+func TestLineEnding(t *testing.T) {
+	dir := t.TempDir()
+	for ending, wantCR := range map[string]bool{"lf": false, "crlf": true, "native": runtime.GOOS == "windows"} {
+		dh := NewDocHelper(dir, "", "document")
+		dh.LineEnding = ending
+		output := filepath.Join(dir, ending+".csv")
+		if err := dh.generateCSVDocument(sampleFiles(), output); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Count(string(data), "\n")
+		if crlf := strings.Count(string(data), "\r\n"); wantCR && crlf != lines || !wantCR && crlf != 0 {
+			t.Errorf("%s: %d of %d lines end in CRLF", ending, crlf, lines)
+		}
+		restored, err := dh.ReadFromCSV(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSameFiles(t, restored, sampleFiles())
+	}
+}
+
+func TestWriteDocumentNoClobberAndBackup(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "times.json")
+	if err := os.WriteFile(out, []byte("important"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dh := newTestHelper(dir, nil)
+	dh.NoClobber = true
+	err := dh.generateJSONDocument(sampleFiles(), out)
+	if code := exitCode(err); err == nil || code != exitOutputFile {
+		t.Fatalf("expected no-clobber failure, got %v (exit code %d)", err, code)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "important" {
+		t.Errorf("existing file was modified: %q", data)
+	}
+
+	dh.NoClobber = false
+	dh.Backup = true
+	if err := dh.generateJSONDocument(sampleFiles(), out); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(out + ".bak"); string(data) != "important" {
+		t.Errorf("backup has unexpected content: %q", data)
+	}
+	if _, _, err := dh.ReadFromJSON(out); err != nil {
+		t.Errorf("new document unreadable: %v", err)
+	}
+}
+
+// vanishingGit deletes each file as it is looked up, simulating a file
+// removed between the walk and the git lookup.
+type vanishingGit struct {
+	dir string
+}
+
+func (v vanishingGit) LastModified(rel string) (time.Time, string, error) {
+	if rel == "gone.md" {
+		os.Remove(filepath.Join(v.dir, rel))
+	}
+	return time.Unix(1700000000, 0), "", nil
+}
+
+func TestFilesRemovedDuringRun(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "kept.md", "gone.md")
+
+	dh := NewDocHelper(dir, "", "document")
+	dh.git = vanishingGit{dir: dir}
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "kept.md" {
+		t.Errorf("expected only kept.md, got %+v", files)
+	}
+
+	files = append(files, FileModTime{Path: "gone.md", LastModified: time.Unix(1700000000, 0)})
+	if err := dh.AdjustFileTimes(files); err != nil {
+		t.Errorf("missing file should be skipped, got %v", err)
+	}
+}
+
+func TestGroupByTopDir(t *testing.T) {
+	at := func(sec int64) time.Time { return time.Unix(sec, 0) }
+	files := []FileModTime{
+		{Path: "/site/content/a.md", LastModified: at(300)},
+		{Path: "/site/index.md", LastModified: at(200)},
+		{Path: "/site/static/x.css", LastModified: at(400)},
+		{Path: "/site/content/b/c.md", LastModified: at(100)},
+	}
+
+	dh := newTestHelper(t.TempDir(), nil)
+	dh.PathPrefix = "/site/"
+	groups := dh.groupByTopDir(files)
+
+	var names []string
+	for _, g := range groups {
+		names = append(names, g.name)
+	}
+	if strings.Join(names, ",") != "static,content,(root)" {
+		t.Errorf("unexpected group order: %v", names)
+	}
+	if len(groups[1].files) != 2 || groups[1].files[0].Path != "/site/content/a.md" {
+		t.Errorf("unexpected content group: %+v", groups[1].files)
+	}
+}
+
+func TestHumanizeAge(t *testing.T) {
+	tests := map[time.Duration]string{
+		-time.Hour:           "just now",
+		30 * time.Second:     "just now",
+		time.Minute:          "1 minute ago",
+		2 * time.Hour:        "2 hours ago",
+		5 * 24 * time.Hour:   "5 days ago",
+		45 * 24 * time.Hour:  "1 month ago",
+		800 * 24 * time.Hour: "2 years ago",
+	}
+	for age, want := range tests {
+		if got := humanizeAge(age); got != want {
+			t.Errorf("humanizeAge(%v) = %q, want %q", age, got, want)
+		}
+	}
+}
+
+func TestRestoreFromDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "docs/b.md")
+	docs := t.TempDir()
+	dh := newTestHelper(dir, nil)
+
+	older := time.Unix(1600000000, 0)
+	newer := time.Unix(1750000000, 0)
+	if err := dh.generateJSONDocument([]FileModTime{
+		{Path: "a.md", LastModified: older, UnixTime: older.Unix()},
+	}, filepath.Join(docs, "team-a.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dh.generateCSVDocument([]FileModTime{
+		{Path: "a.md", LastModified: newer, UnixTime: newer.Unix()},
+		{Path: "docs/b.md", LastModified: older, UnixTime: older.Unix()},
+	}, filepath.Join(docs, "team-b.csv")); err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, docs, "notes.txt")
+
+	if err := dh.RestoreFromFile(docs); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]time.Time{"a.md": newer, "docs/b.md": older} {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(want) {
+			t.Errorf("%s: mtime %v, want %v", path, info.ModTime(), want)
+		}
+	}
+}
+
+func TestSplitByDir(t *testing.T) {
+	dir := t.TempDir()
+	out := t.TempDir()
+	files := []FileModTime{
+		{Path: "content/a.md", LastModified: time.Unix(1700000000, 0), UnixTime: 1700000000},
+		{Path: "static/x.css", LastModified: time.Unix(1710000000, 0), UnixTime: 1710000000},
+		{Path: "index.md", LastModified: time.Unix(1720000000, 0), UnixTime: 1720000000},
+	}
+
+	dh := NewDocHelper(dir, out+string(filepath.Separator), "document")
+	dh.SplitByDir = true
+	if err := dh.GenerateDocument(files); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"times-content.json", "times-static.json", "times-root.json"} {
+		got, _, err := dh.ReadFromJSON(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 {
+			t.Errorf("%s: got %d files, want 1", name, len(got))
+		}
+	}
+
+	dh.Output = filepath.Join(out, "meta.csv")
+	if err := dh.GenerateDocument(files); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dh.ReadFromCSV(filepath.Join(out, "meta-content.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Path != "content/a.md" {
+		t.Errorf("unexpected split CSV contents: %+v", got)
+	}
+}
+
+func TestMinTime(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "old.md", "new.md")
+	floor := time.Unix(1500000000, 0)
+	git := fakeGit{"old.md": time.Unix(0, 0).Add(time.Hour), "new.md": time.Unix(1700000000, 0)}
+
+	dh := newTestHelper(dir, git)
+	dh.MinTime = floor
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	if len(files) != 2 || !files[1].LastModified.Equal(floor) || files[1].UnixTime != floor.Unix() {
+		t.Errorf("expected old.md clamped to the floor, got %+v", files)
+	}
+
+	dh.MinTimeAction = "skip"
+	files, err = dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "new.md" {
+		t.Errorf("expected old.md skipped, got %+v", files)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	for _, value := range []string{"2020-01-02", "2020-01-02 03:04:05", "2020-01-02T03:04:05Z"} {
+		if _, err := parseDate(value); err != nil {
+			t.Errorf("parseDate(%q): %v", value, err)
+		}
+	}
+	if _, err := parseDate("yesterday"); err == nil {
+		t.Error("expected an error for an unparseable date")
+	}
+}
+
+func TestDedupeHardlinks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "c.md")
+	if err := os.Link(filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+	at := time.Unix(1700000000, 0)
+	git := fakeGit{"a.md": at, "b.md": at, "c.md": at}
+
+	dh := newTestHelper(dir, git)
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("without dedupe: got %d files, want 3", len(files))
+	}
+
+	dh.DedupeHardlinks = true
+	files, err = dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	if len(files) != 2 || files[0].Path != "a.md" || files[1].Path != "c.md" {
+		t.Errorf("with dedupe: got %+v, want a.md and c.md", files)
+	}
+}
+
+func TestDirectoryEntries(t *testing.T) {
+	at := func(sec int64) time.Time { return time.Unix(sec, 0) }
+	files := []FileModTime{
+		{Path: "index.md", LastModified: at(500)},
+		{Path: filepath.Join("content", "a.md"), LastModified: at(100)},
+		{Path: filepath.Join("content", "posts", "b.md"), LastModified: at(300)},
+		{Path: filepath.Join("content", "posts", "c.md"), LastModified: at(200)},
+	}
+
+	dirs := directoryEntries(files)
+	want := map[string]int64{"content": 300, filepath.Join("content", "posts"): 300}
+	if len(dirs) != len(want) {
+		t.Fatalf("got %d directories, want %d: %+v", len(dirs), len(want), dirs)
+	}
+	for _, d := range dirs {
+		if !d.IsDir || d.UnixTime != want[d.Path] {
+			t.Errorf("unexpected directory entry %+v", d)
+		}
+	}
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "times.csv")
+	dh := newTestHelper(dir, nil)
+	withDirs := slashPaths(append(files, dirs...))
+	if err := dh.generateCSVDocument(withDirs, out); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dh.ReadFromCSV(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if got[i].IsDir != withDirs[i].IsDir {
+			t.Errorf("%s: IsDir %v after CSV round trip, want %v", got[i].Path, got[i].IsDir, withDirs[i].IsDir)
+		}
+	}
+}
+
+func TestRestoreDirectoryTimes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "content/posts/b.md", "content/a.md")
+
+	at := func(sec int64) time.Time { return time.Unix(sec, 0) }
+	files := []FileModTime{
+		{Path: "content", LastModified: at(300), IsDir: true},
+		{Path: "content/posts", LastModified: at(200), IsDir: true},
+		{Path: "content/posts/b.md", LastModified: at(200)},
+		{Path: "content/a.md", LastModified: at(300)},
+	}
+	out := filepath.Join(dir, "times.json")
+	dh := newTestHelper(dir, nil)
+	if err := dh.generateJSONDocument(files, out); err != nil {
+		t.Fatal(err)
+	}
+	dh.Workers = 4
+	if err := dh.RestoreFromFile(out); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range files {
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(f.LastModified) {
+			t.Errorf("%s: mtime %v, want %v", f.Path, info.ModTime(), f.LastModified)
+		}
+	}
+
+	regular, dirs := splitDirectories(files)
+	if len(regular) != 2 || len(dirs) != 2 || dirs[0].Path != "content/posts" {
+		t.Errorf("splitDirectories = %+v, %+v; want files then content/posts first", regular, dirs)
+	}
+}
+
+func TestPostAdjustCmd(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell command")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "docs/b.md")
+	marker := filepath.Join(t.TempDir(), "hook.txt")
+
+	dh := newTestHelper(dir, nil)
+	dh.PostAdjustCmd = `echo "$DOCHELPER_ADJUSTED/$DOCHELPER_FAILED" > ` + marker
+	if err := dh.AdjustFileTimes(sampleFiles()); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(marker); strings.TrimSpace(string(data)) != "2/0" {
+		t.Errorf("hook saw %q, want 2/0", data)
+	}
+
+	dh.PostAdjustCmd = "exit 7"
+	if code := exitCode(dh.AdjustFileTimes(sampleFiles())); code != 7 {
+		t.Errorf("exit code %d, want the hook's 7", code)
+	}
+}
+
+func TestReadFromJSONSchemaVersions(t *testing.T) {
+	dir := t.TempDir()
+	dh := newTestHelper(dir, nil)
+
+	out := filepath.Join(dir, "current.json")
+	if err := dh.generateJSONDocument(sampleFiles(), out); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(out)
+	if !strings.Contains(string(data), `"schema_version": `+strconv.Itoa(schemaVersion)) {
+		t.Errorf("generated document lacks schema version %d", schemaVersion)
+	}
+
+	// A version 1 document cannot carry directory entries.
+	v1 := filepath.Join(dir, "v1.json")
+	doc := `{"schema_version": 1, "files": [{"path": "a", "last_modified": "2023-11-14T22:13:20Z", "is_dir": true}]}`
+	if err := os.WriteFile(v1, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, _, err := dh.ReadFromJSON(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].IsDir || files[0].UnixTime != 1700000000 {
+		t.Errorf("version 1 document not migrated: %+v", files[0])
+	}
+}
+
+func TestLimit(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "b.md", "c/d.md", "c/e.md")
+	at := time.Unix(1700000000, 0)
+	dh := newTestHelper(dir, fakeGit{"a.md": at, "b.md": at, "c/d.md": at, "c/e.md": at})
+	dh.Limit = 3
+
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("got %d files, want 3", len(files))
+	}
+}
+
+func TestWithMode(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "run.sh")
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	dh := newTestHelper(dir, fakeGit{"run.sh": time.Unix(1700000000, 0)})
+	dh.WithMode = true
+
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Mode != 0o750 {
+		t.Fatalf("got %+v, want mode 0750", files)
+	}
+
+	csvPath := filepath.Join(t.TempDir(), "times.csv")
+	if err := dh.generateCSVDocument(files, csvPath); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := dh.ReadFromCSV(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || restored[0].Mode != 0o750 {
+		t.Fatalf("CSV round trip got %+v, want mode 0750", restored)
+	}
+
+	if err := os.Chmod(filepath.Join(dir, "run.sh"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dh.AdjustFileTimes(restored); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "run.sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o750 {
+		t.Errorf("mode after restore = %o, want 750", info.Mode().Perm())
+	}
+}
+
+func TestJSONCompact(t *testing.T) {
+	dir := t.TempDir()
+	files := []FileModTime{{Path: "a.md", LastModified: time.Unix(1700000000, 0).UTC(), UnixTime: 1700000000}}
+	dh := NewDocHelper(dir, "", "document")
+	dh.JSONCompact = true
+
+	output := filepath.Join(dir, "times.json")
+	if err := dh.generateJSONDocument(files, output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.ContainsRune(data, '\n') {
+		t.Errorf("compact JSON contains newlines: %s", data)
+	}
+	restored, _, err := dh.ReadFromJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || restored[0].Path != "a.md" {
+		t.Errorf("got %+v", restored)
+	}
+}
+
+func TestJSONShapeMap(t *testing.T) {
+	dir := t.TempDir()
+	dh := NewDocHelper(dir, "", "document")
+	dh.JSONShape = "map"
+
+	output := filepath.Join(dir, "times.json")
+	files := sampleFiles()
+	files[0].Mode = 0644
+	if err := dh.generateJSONDocument(files, output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("map document is not an object of records: %v\n%s", err, data)
+	}
+	record, ok := raw["a.md"]
+	if !ok || record["unix_time"] == nil {
+		t.Fatalf("no record keyed by a.md: %s", data)
+	}
+	if _, ok := record["path"]; ok {
+		t.Errorf("record repeats its path: %v", record)
+	}
+
+	restored, _, err := dh.ReadFromJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, restored, files)
+	if restored[0].Mode != 0644 {
+		t.Errorf("mode = %v after map round trip, want 0644", restored[0].Mode)
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	dir := t.TempDir()
+	files := []FileModTime{{Path: "a.md", LastModified: time.Unix(1700000000, 0), UnixTime: 1700000000}}
+	dh := NewDocHelper(dir, "", "document")
+	dh.Columns = []string{"unix_time", "path"}
+	dh.HeaderNames = map[string]string{"path": "file", "unix_time": "epoch"}
+
+	output := filepath.Join(dir, "times.csv")
+	if err := dh.generateCSVDocument(files, output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "epoch,file\n1700000000,a.md\n"; string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+
+	restored, err := dh.ReadFromCSV(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || restored[0].Path != "a.md" || restored[0].UnixTime != 1700000000 {
+		t.Errorf("got %+v", restored)
+	}
+}
+
+func TestCSVQuotesPaths(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Unix(1700000000, 0)
+	files := []FileModTime{
+		{Path: "c,d.md", LastModified: at, UnixTime: at.Unix()},
+		{Path: `say "hi".md`, LastModified: at, UnixTime: at.Unix()},
+	}
+	dh := NewDocHelper(dir, "", "document")
+
+	output := filepath.Join(dir, "times.csv")
+	if err := dh.generateCSVDocument(files, output); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := dh.ReadFromCSV(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSameFiles(t, restored, files)
+}
+
+func TestCSVLastModifiedRoundTripOutsideUTC(t *testing.T) {
+	saved := time.Local
+	time.Local = time.FixedZone("JST", 9*60*60)
+	defer func() { time.Local = saved }()
+
+	dir := t.TempDir()
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).In(time.Local)
+	files := []FileModTime{{Path: "a.md", LastModified: at, UnixTime: at.Unix()}}
+	dh := NewDocHelper(dir, "", "document")
+	dh.Columns = []string{"path", "last_modified"}
+
+	output := filepath.Join(dir, "times.csv")
+	if err := dh.generateCSVDocument(files, output); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := dh.ReadFromCSV(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || !restored[0].LastModified.Equal(at) {
+		t.Errorf("got %+v, want %s", restored, at.UTC())
+	}
+}
+
+func TestParseColumns(t *testing.T) {
+	if _, err := parseColumns("path,size"); err == nil {
+		t.Error("unknown column accepted")
+	}
+	if _, err := parseHeaderNames("path"); err == nil {
+		t.Error("header name without = accepted")
+	}
+	names, err := parseHeaderNames("path=file, unix_time=epoch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names["path"] != "file" || names["unix_time"] != "epoch" {
+		t.Errorf("got %v", names)
+	}
+}
+
+func TestAdjustProgressAccumulates(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "b.md")
+	dh := NewDocHelper(dir, "", "adjust")
+	dh.progress = &adjustProgress{}
+	at := time.Unix(1700000000, 0)
+
+	for _, files := range [][]FileModTime{
+		{{Path: "a.md", LastModified: at}, {Path: "gone.md", LastModified: at}},
+		{{Path: "b.md", LastModified: at}},
+	} {
+		if err := dh.AdjustFileTimes(files); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := dh.progress.adjusted.Load(); got != 2 {
+		t.Errorf("adjusted = %d, want 2", got)
+	}
+	if got := dh.progress.skipped.Load(); got != 1 {
+		t.Errorf("skipped = %d, want 1", got)
+	}
+}
+
+func TestRestoreSniffsFormat(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "b.md")
+	docs := t.TempDir()
+	documents := map[string]string{
+		"times.data": "\n  [{\"path\": \"a.md\", \"last_modified\": \"2023-11-14T22:13:20Z\", \"unix_time\": 1700000000}]",
+		"times.txt":  "path,last_modified,unix_time\nb.md,2023-11-14 22:13:20,1700000000\n",
+	}
+
+	for name, content := range documents {
+		path := filepath.Join(docs, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		dh := NewDocHelper(dir, path, "restore")
+		if err := dh.RestoreFromFile(path); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"a.md", "b.md"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ModTime().Unix() != 1700000000 {
+			t.Errorf("%s: mtime %d, want 1700000000", name, info.ModTime().Unix())
+		}
+	}
+
+	empty := filepath.Join(docs, "empty.data")
+	if err := os.WriteFile(empty, []byte("  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDocHelper(dir, empty, "restore").RestoreFromFile(empty); err == nil {
+		t.Error("empty document accepted")
+	}
+}
+
+// flakyGit fails transiently a fixed number of times before answering.
+type flakyGit struct {
+	failures int
+	calls    int
+}
+
+func (f *flakyGit) LastModified(rel string) (time.Time, string, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return time.Time{}, "", &transientGitError{syscall.EAGAIN}
+	}
+	return time.Unix(1700000000, 0), "", nil
+}
+
+func TestGitRetries(t *testing.T) {
+	defer func(backoff time.Duration) { gitRetryBackoff = backoff }(gitRetryBackoff)
+	gitRetryBackoff = time.Millisecond
+	dir := t.TempDir()
+
+	flaky := &flakyGit{failures: 2}
+	dh := NewDocHelper(dir, "", "document")
+	dh.git = flaky
+	got, _, err := dh.GetGitLastModified(filepath.Join(dir, "a.md"))
+	if err != nil || got.Unix() != 1700000000 || flaky.calls != 3 {
+		t.Errorf("got %v, %v after %d calls, want success on the third", got, err, flaky.calls)
+	}
+
+	flaky = &flakyGit{failures: 5}
+	dh = NewDocHelper(dir, "", "document")
+	dh.git = flaky
+	dh.GitRetries = 2
+	if _, _, err := dh.GetGitLastModified(filepath.Join(dir, "a.md")); err == nil || flaky.calls != 2 {
+		t.Errorf("got %v after %d calls, want an error after 2", err, flaky.calls)
+	}
+}
+
+func TestTransientOrNil(t *testing.T) {
+	var transient *transientGitError
+	if err := transientOrNil(errors.New("fatal: Unable to create '/repo/.git/index.lock': File exists")); !errors.As(err, &transient) {
+		t.Error("index.lock failure not treated as transient")
+	}
+	if err := transientOrNil(errors.New("exit status 128")); err != nil {
+		t.Errorf("permanent failure reported as %v", err)
+	}
+}
+
+func TestExpandOutputName(t *testing.T) {
+	at := time.Date(2024, 6, 1, 23, 30, 5, 0, time.UTC)
+	dh := NewDocHelper("", "", "document")
+	dh.FilenameTZ = "UTC"
+
+	if got := dh.expandOutputName("out/times-{date}.json", at); got != "out/times-2024-06-01.json" {
+		t.Errorf("got %s", got)
+	}
+	if got := dh.expandOutputName("times-{date}T{time}.json", at); got != "times-2024-06-01T233005.json" {
+		t.Errorf("got %s", got)
+	}
+
+	dh.FilenameTZ = "Asia/Tokyo"
+	dh.FilenameDateFormat = "20060102"
+	if got := dh.expandOutputName("times-{date}.json", at); got != "times-20240602.json" {
+		t.Errorf("with time zone got %s", got)
+	}
+}
+
+func TestCheckTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "times.json")
+	doc := `{"schema_version": 4, "files": [
+		{"path": "a.md", "last_modified": "2023-11-14T22:13:20Z", "unix_time": 1700000000},
+		{"path": "b.md", "last_modified": "2023-11-14T22:13:20Z", "unix_time": 1600000000},
+		{"path": "c.md", "unix_time": 1700000000}
+	]}`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dh := NewDocHelper(t.TempDir(), path, "restore")
+	files, _, err := dh.ReadFromJSON(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[1].UnixTime != 1700000000 {
+		t.Errorf("mismatched unix_time = %d, want last_modified's 1700000000", files[1].UnixTime)
+	}
+	if files[2].LastModified.Unix() != 1700000000 {
+		t.Errorf("missing last_modified not filled from unix_time: %v", files[2].LastModified)
+	}
+
+	dh.Strict = true
+	if _, _, err := dh.ReadFromJSON(path); err == nil {
+		t.Error("--strict accepted disagreeing times")
+	}
+}
+
+func TestFailOnZero(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "untracked.md")
+	dh := newTestHelper(dir, fakeGit{"a.md": time.Unix(1700000000, 0)})
+
+	if _, err := dh.ScanDirectory(); err != nil {
+		t.Fatalf("without --fail-on-zero: %v", err)
+	}
+
+	dh.FailOnZero = true
+	files, err := dh.ScanDirectory()
+	if err == nil || !strings.Contains(err.Error(), "1 files") {
+		t.Errorf("got error %v, want one file without history", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got %d files, want the 1 with history", len(files))
+	}
+}
+
+func TestGenerateSeveralOutputs(t *testing.T) {
+	dir := t.TempDir()
+	out := t.TempDir()
+	dh := NewDocHelper(dir, filepath.Join(out, "times.json"), "document")
+	dh.Outputs = stringList{filepath.Join(out, "times.csv"), filepath.Join(out, "times.md")}
+
+	files := []FileModTime{{Path: "a.md", LastModified: time.Unix(1700000000, 0), UnixTime: 1700000000}}
+	if err := dh.GenerateDocument(files); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, prefix := range map[string]string{
+		"times.json": "{",
+		"times.csv":  "path,",
+		"times.md":   "# ",
+	} {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), prefix) {
+			t.Errorf("%s starts with %q, want %q", name, data[:min(len(data), 10)], prefix)
+		}
+	}
+}
+
+func TestWriteToWriter(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	files := []FileModTime{{Path: "a.md", LastModified: at, UnixTime: at.Unix()}}
+	dh := NewDocHelper(t.TempDir(), "", "document")
+
+	var buf bytes.Buffer
+	if err := dh.WriteJSON(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+	var doc Document
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("WriteJSON output is not JSON: %v", err)
+	}
+	if len(doc.Files) != 1 || doc.Files[0].Path != "a.md" {
+		t.Errorf("WriteJSON files = %+v", doc.Files)
+	}
+
+	buf.Reset()
+	if err := dh.WriteCSV(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+	if want := "path,last_modified,unix_time\n"; !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("WriteCSV output = %q, want header %q", buf.String(), want)
+	}
+
+	// The file-writing variants produce the same bytes.
+	path := filepath.Join(t.TempDir(), "times.csv")
+	if err := dh.generateCSVDocument(files, path); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != buf.String() {
+		t.Errorf("file content %q differs from WriteCSV %q", data, buf.String())
+	}
+}
+
+func TestKeepNewer(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "edited.md", "stale.md")
+	git := time.Unix(1700000000, 0)
+	older := git.Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "stale.md"), older, older); err != nil {
+		t.Fatal(err)
+	}
+
+	dh := NewDocHelper(dir, "", "adjust")
+	dh.KeepNewer = true
+	dh.progress = &adjustProgress{}
+	files := []FileModTime{{Path: "edited.md", LastModified: git}, {Path: "stale.md", LastModified: git}}
+	if err := dh.AdjustFileTimes(files); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"edited.md": false, "stale.md": true} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.ModTime().Equal(git); got != want {
+			t.Errorf("%s set to git time = %v, want %v", name, got, want)
+		}
+	}
+	if got := dh.progress.newer.Load(); got != 1 {
+		t.Errorf("newer = %d, want 1", got)
+	}
+}
+
+func TestNoGit(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "sub/b.md")
+	at := time.Unix(1700000000, 0)
+	if err := os.Chtimes(filepath.Join(dir, "sub", "b.md"), at, at); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(t.TempDir(), "times.json")
+	dh := NewDocHelper(dir, output, "document")
+	dh.NoGit = true
+	if err := dh.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _, err := dh.ReadFromJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	for _, file := range files {
+		if file.Path == "sub/b.md" && file.UnixTime != at.Unix() {
+			t.Errorf("sub/b.md unix_time = %d, want %d", file.UnixTime, at.Unix())
+		}
+	}
+
+	dh.Mode = "adjust"
+	if err := dh.Run(); err == nil {
+		t.Error("--no-git accepted in adjust mode")
+	}
+}
+
+func TestPreview(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "b.md")
+	at := time.Date(2024, 3, 15, 0, 0, 0, 0, time.Local)
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)
+	for name, mtime := range map[string]time.Time{"a.md": old, "b.md": at} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dh := NewDocHelper(dir, "", "adjust")
+	var buf bytes.Buffer
+	files := []FileModTime{{Path: "a.md", LastModified: at}, {Path: "b.md", LastModified: at}}
+	if err := dh.previewFileTimes(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+	if want := "a.md: 2024-01-01 00:00:00 -> 2024-03-15 00:00:00\n"; buf.String() != want {
+		t.Errorf("preview = %q, want %q", buf.String(), want)
+	}
+
+	dh.Preview = true
+	if err := dh.AdjustFileTimes(files); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(filepath.Join(dir, "a.md")); !info.ModTime().Equal(old) {
+		t.Errorf("preview changed a.md to %s", info.ModTime())
+	}
+}
+
+func TestMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "b.md", "c.css")
+	at := time.Unix(1700000000, 0)
+	dh := newTestHelper(dir, fakeGit{"a.md": at, "b.md": at, "c.css": at})
+	dh.MaxFiles = 2
+
+	if _, err := dh.ScanDirectory(); err == nil || !strings.Contains(err.Error(), "--max-files") {
+		t.Errorf("err = %v, want a --max-files error", err)
+	}
+
+	dh.Exts = stringList{"md"}
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files, want 2", len(files))
+	}
+}
+
+func TestConfirmAdjust(t *testing.T) {
+	dh := NewDocHelper(t.TempDir(), "", "adjust")
+
+	if err := dh.confirmAdjust(strings.NewReader("y\n"), true, 3); err != nil {
+		t.Errorf("y: %v", err)
+	}
+	for _, answer := range []string{"\n", "n\n", "maybe\n", ""} {
+		if err := dh.confirmAdjust(strings.NewReader(answer), true, 3); err == nil {
+			t.Errorf("%q accepted", answer)
+		}
+	}
+	if err := dh.confirmAdjust(strings.NewReader("y\n"), false, 3); err == nil {
+		t.Error("confirmed without a terminal")
+	}
+
+	dh.Yes = true
+	if err := dh.confirmAdjust(strings.NewReader(""), false, 3); err != nil {
+		t.Errorf("--yes: %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.json")
+
+	dh := NewDocHelper(dir, missing, "restore")
+	if err := dh.Run(); !errors.Is(err, ErrInputMissing) {
+		t.Errorf("missing input: %v, want ErrInputMissing", err)
+	}
+	if _, err := dh.ReadFromCSV(missing); !errors.Is(err, ErrInputMissing) {
+		t.Errorf("ReadFromCSV: %v, want ErrInputMissing", err)
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := NewDocHelper(dir, bad, "restore").Run()
+	if !errors.Is(err, ErrMalformedDocument) || errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("malformed JSON: %v, want only ErrMalformedDocument", err)
+	}
+
+	unknown := NewDocHelper(dir, "", "document")
+	unknown.Format = "yaml"
+	if err := unknown.Run(); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("unknown --format: %v, want ErrUnsupportedFormat", err)
+	}
+
+	empty := filepath.Join(dir, "empty.json")
+	if err := os.WriteFile(empty, []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewDocHelper(dir, empty, "restore").Run(); !errors.Is(err, ErrNoFiles) {
+		t.Errorf("empty document: %v, want ErrNoFiles", err)
+	}
+
+	if err := NewDocHelper(dir, "", "document").Run(); !errors.Is(err, ErrNotARepo) {
+		t.Errorf("plain directory: %v, want ErrNotARepo", err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "b.md")
+	dh := newTestHelper(dir, fakeGit{"a.md": time.Unix(1700000000, 0), "b.md": time.Unix(1700000000, 0)})
+	dh.WithChecksum = true
+
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvPath := filepath.Join(t.TempDir(), "times.csv")
+	if err := dh.generateCSVDocument(files, csvPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// b.md changes after the document was written.
+	if err := os.WriteFile(filepath.Join(dir, "b.md"), []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restore := NewDocHelper(dir, csvPath, "restore")
+	restore.VerifyChecksum = true
+	if err := restore.RestoreFromFile(csvPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]bool{"a.md": true, "b.md": false} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.ModTime().Unix() == 1700000000; got != want {
+			t.Errorf("%s restored = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// stringList is a flag.Value collecting every occurrence of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// RunDirs runs the configured mode against every directory in Dirs. The
+// options are validated once up front, then each directory is checked and
+// processed independently; a failure is reported and the remaining
+// directories still run unless Strict is set.
+// With Merge, document mode writes a single document whose paths are
+// relative to the directories' common parent.
+func (dh *DocHelper) RunDirs() error {
+	if err := dh.validateOptions(); err != nil {
+		return err
+	}
+	if dh.GitDir != "" {
+		return fmt.Errorf("--git-dir applies to a single target directory and cannot be used with several --dir")
+	}
+	if err := dh.checkGitInstalled(); err != nil {
+		return err
+	}
+	if dh.Merge {
+		return dh.runMerged()
+	}
+
+	var firstErr error
+	failed := 0
+	for _, dir := range dh.Dirs {
+		slog.Info("Processing directory", "path", dir)
+
+		h := dh.forDir(dir)
+		if dh.Output != "" && h.Mode == "document" {
+			h.Output = suffixOutput(dh.Output, filepath.Base(dir))
+			h.Outputs = nil
+			for _, output := range dh.Outputs {
+				h.Outputs = append(h.Outputs, suffixOutput(output, filepath.Base(dir)))
+			}
+		}
+
+		if err := h.Run(); err != nil {
+			if errors.Is(err, errInterrupted) {
+				return err
+			}
+			slog.Error("directory failed", "path", dir, "error", err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			if dh.Strict {
+				break
+			}
+		}
+	}
+
+	slog.Info("Processed directories", "count", len(dh.Dirs), "succeeded", len(dh.Dirs)-failed, "failed", failed)
+	if firstErr != nil {
+		return withExitCode(exitCode(firstErr), fmt.Errorf("%d of %d directories failed", failed, len(dh.Dirs)))
+	}
+	return nil
+}
+
+func (dh *DocHelper) runMerged() error {
+	if dh.Mode != "document" {
+		return fmt.Errorf("--merge is only supported in document mode")
+	}
+
+	root := commonParent(dh.Dirs)
+	if dh.RelativeTo != "" {
+		root = dh.RelativeTo
+	}
+	if dh.Timing && dh.timing == nil {
+		dh.timing = &phaseTimes{}
+		defer dh.timing.log()
+	}
+
+	var merged []FileModTime
+	var firstErr error
+	failed := 0
+	for _, dir := range dh.Dirs {
+		h := dh.forDir(dir)
+		files, err := h.scanRepo()
+		if errors.Is(err, errInterrupted) {
+			return err
+		}
+		if errors.Is(err, errNoCommits) {
+			slog.Warn(err.Error()+", skipping", "path", dir)
+			continue
+		}
+		if err == nil {
+			files, err = h.processScanned(files)
+		}
+		if err != nil {
+			slog.Error("directory failed", "path", dir, "error", err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			if dh.Strict {
+				return err
+			}
+			continue
+		}
+
+		slog.Info("Found files", "count", len(files), "path", dir)
+		if files, err = rebasePaths(files, dir, root); err != nil {
+			return err
+		}
+		merged = append(merged, files...)
+	}
+
+	if len(merged) == 0 && firstErr == nil {
+		slog.Warn("no files found in git")
+		return nil
+	}
+	if dh.CountOnly {
+		printStats(merged)
+	} else if err := dh.forDir(root).GenerateDocument(merged); err != nil {
+		return err
+	}
+
+	slog.Info("Processed directories", "count", len(dh.Dirs), "succeeded", len(dh.Dirs)-failed, "failed", failed)
+	if firstErr != nil {
+		return withExitCode(exitCode(firstErr), fmt.Errorf("%d of %d directories failed", failed, len(dh.Dirs)))
+	}
+	return nil
+}
+
+// forDir returns a copy of dh targeting dir. A shared cache file is split
+// per directory so the repositories don't evict each other's entries.
+func (dh *DocHelper) forDir(dir string) *DocHelper {
+	h := *dh
+	h.TargetDir = dir
+	if dh.CachePath != "" && len(dh.Dirs) > 1 {
+		h.CachePath = suffixOutput(dh.CachePath, filepath.Base(dir))
+	}
+	h.Dirs = nil
+	h.git = nil
+	h.cache = nil
+	return &h
+}
+
+// suffixOutput inserts -suffix before the document extension of path, so
+// times.json.gz becomes times-suffix.json.gz.
+func suffixOutput(path, suffix string) string {
+	ext := documentExt(path)
+	if isGzipPath(path) {
+		ext += path[len(path)-len(".gz"):]
+	}
+	base := path[:len(path)-len(ext)]
+	return base + "-" + suffix + path[len(base):]
+}
+
+// commonParent returns the deepest directory containing every dir.
+func commonParent(dirs []string) string {
+	root := filepath.Dir(dirs[0])
+	for _, dir := range dirs {
+		for {
+			rel, err := filepath.Rel(root, dir)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			parent := filepath.Dir(root)
+			if parent == root {
+				break
+			}
+			root = parent
+		}
+	}
+	return root
+}
+
+// rebasePaths turns paths relative to dir into paths relative to root, for
+// --relative-to. It fails when a file lies outside root.
+func rebasePaths(files []FileModTime, dir, root string) ([]FileModTime, error) {
+	rebased := make([]FileModTime, len(files))
+	for i, file := range files {
+		rel, err := filepath.Rel(root, filepath.Join(dir, file.Path))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("%s is outside --relative-to %s", filepath.Join(dir, file.Path), root)
+		}
+		file.Path = rel
+		rebased[i] = file
+	}
+	return rebased, nil
+}
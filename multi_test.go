@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSuffixOutput(t *testing.T) {
+	tests := map[string]string{
+		"times.json":         "times-docs.json",
+		"out/times.csv.gz":   "out/times-docs.csv.gz",
+		"times":              "times-docs",
+		"/abs/times.JSON.GZ": "/abs/times-docs.JSON.GZ",
+	}
+	for in, want := range tests {
+		if got := suffixOutput(in, "docs"); got != want {
+			t.Errorf("suffixOutput(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRunDirs(t *testing.T) {
+	parent := t.TempDir()
+	repoA := filepath.Join(parent, "a")
+	repoB := filepath.Join(parent, "b")
+	notRepo := filepath.Join(parent, "plain")
+	for _, dir := range []string{repoA, repoB, notRepo} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, dir := range []string{repoA, repoB} {
+		repo := initGitRepo(t)
+		if err := os.Rename(filepath.Join(repo, ".git"), filepath.Join(dir, ".git")); err != nil {
+			t.Fatal(err)
+		}
+		commitFiles(t, dir, "2024-01-01T00:00:00Z", "index.md")
+	}
+
+	out := filepath.Join(t.TempDir(), "times.json")
+	dh := NewDocHelper(repoA, out, "document")
+	dh.Dirs = stringList{repoA, notRepo, repoB}
+
+	err := dh.RunDirs()
+	if code := exitCode(err); err == nil || code != exitTargetDir {
+		t.Fatalf("expected the plain directory to fail, got %v (exit code %d)", err, code)
+	}
+	for _, name := range []string{"times-a.json", "times-b.json"} {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(out), name)); err != nil {
+			t.Errorf("missing per-directory output %s: %v", name, err)
+		}
+	}
+
+	dh.Dirs = stringList{repoA, repoB}
+	dh.Merge = true
+	if err := dh.RunDirs(); err != nil {
+		t.Fatal(err)
+	}
+	files, _, err := dh.ReadFromJSON(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		seen[filepath.ToSlash(f.Path)] = true
+	}
+	if len(files) != 2 || !seen["a/index.md"] || !seen["b/index.md"] {
+		t.Errorf("unexpected merged files: %+v", files)
+	}
+
+	// A merged run reports a failed directory with its own exit code too.
+	dh.Dirs = stringList{repoA, notRepo, repoB}
+	err = dh.RunDirs()
+	if code := exitCode(err); err == nil || code != exitTargetDir {
+		t.Errorf("merged run with a plain directory: got %v (exit code %d), want exit code %d", err, code, exitTargetDir)
+	}
+
+	dh.Dirs = stringList{repoA, repoB}
+	dh.Format = "nosuch"
+	if err := dh.RunDirs(); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("merged run with an unknown --format: got %v, want %v", err, ErrUnsupportedFormat)
+	}
+
+	// Options are validated before any directory is scanned.
+	dh.Format = ""
+	dh.DateKind = "bogus"
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	err = dh.RunDirs()
+	if code := exitCode(err); err == nil || code != exitUsage {
+		t.Errorf("merged run with --date-kind bogus: got %v (exit code %d), want exit code %d", err, code, exitUsage)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("merged run with invalid options wrote %s", out)
+	}
+}
+
+func TestRunDirsMergedMaxAge(t *testing.T) {
+	parent := t.TempDir()
+	recent := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(parent, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		repo := initGitRepo(t)
+		if err := os.Rename(filepath.Join(repo, ".git"), filepath.Join(dir, ".git")); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("GIT_COMMITTER_DATE", "2020-01-01T00:00:00Z")
+		commitFiles(t, dir, "2020-01-01T00:00:00Z", "old.md")
+		t.Setenv("GIT_COMMITTER_DATE", recent)
+		commitFiles(t, dir, recent, "new.md")
+	}
+
+	out := filepath.Join(t.TempDir(), "times.json")
+	dh := NewDocHelper(parent, out, "document")
+	dh.Dirs = stringList{filepath.Join(parent, "a"), filepath.Join(parent, "b")}
+	dh.Merge = true
+	dh.MaxAge = 24 * time.Hour
+	if err := dh.RunDirs(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _, err := dh.ReadFromJSON(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		got = append(got, filepath.ToSlash(f.Path))
+	}
+	sort.Strings(got)
+	if want := []string{"a/new.md", "b/new.md"}; !slices.Equal(got, want) {
+		t.Errorf("merged --max-age kept %v, want %v", got, want)
+	}
+}
+
+func TestRebasePaths(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "site")
+	dir := filepath.Join(root, "docs")
+	files := []FileModTime{{Path: filepath.Join("guide", "a.md")}}
+
+	got, err := rebasePaths(files, dir, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join("docs", "guide", "a.md"); got[0].Path != want {
+		t.Errorf("path = %q, want %q", got[0].Path, want)
+	}
+	if files[0].Path != filepath.Join("guide", "a.md") {
+		t.Error("rebasePaths modified its input")
+	}
+
+	if _, err := rebasePaths(files, dir, filepath.Join(root, "other")); err == nil {
+		t.Error("file outside --relative-to accepted")
+	}
+}
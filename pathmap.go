@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// pathMapRecord is a file record in a map-shaped JSON document. Its empty
+// Path shadows the embedded one, so the path appears only as the key.
+type pathMapRecord struct {
+	FileModTime
+	Path string `json:"path,omitempty"`
+}
+
+// pathMap keys files by path for --json-shape map.
+func pathMap(files []FileModTime) map[string]pathMapRecord {
+	m := make(map[string]pathMapRecord, len(files))
+	for _, file := range files {
+		m[file.Path] = pathMapRecord{FileModTime: file}
+	}
+	return m
+}
+
+// isPathMap reports whether data is a JSON object keyed by path rather
+// than a document with a files array.
+func isPathMap(data []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) == 0 {
+		return false
+	}
+	if files, ok := fields["files"]; ok && !bytes.HasPrefix(bytes.TrimSpace(files), []byte("{")) {
+		return false
+	}
+	for _, value := range fields {
+		if !bytes.HasPrefix(bytes.TrimSpace(value), []byte("{")) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePathMap reads a map-shaped JSON document, ordered by path.
+func parsePathMap(data []byte) ([]FileModTime, error) {
+	var m map[string]FileModTime
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	files := make([]FileModTime, 0, len(m))
+	for path, file := range m {
+		file.Path = path
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// WriteUnixMap writes files to w as a flat JSON object mapping each path to
+// its Unix time, for --format unixmap.
+func (dh *DocHelper) WriteUnixMap(w io.Writer, files []FileModTime) error {
+	m := make(map[string]int64, len(files))
+	for _, file := range files {
+		m[file.Path] = file.UnixTime
+	}
+
+	var data []byte
+	var err error
+	if dh.JSONCompact {
+		data, err = json.Marshal(m)
+	} else {
+		data, err = json.MarshalIndent(m, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("cannot serialize JSON: %v", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (dh *DocHelper) generateUnixMapDocument(files []FileModTime, outputPath string) error {
+	var buf bytes.Buffer
+	if err := dh.WriteUnixMap(&buf, files); err != nil {
+		return err
+	}
+
+	err := dh.writeDocument(outputPath, buf.Bytes())
+	if err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+
+	slog.Info("Generated Unix time map", "path", outputPath, "files", len(files))
+	return nil
+}
+
+// isUnixMap reports whether data is a flat JSON object of path to Unix
+// time, as written by --format unixmap.
+func isUnixMap(data []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || len(fields) == 0 {
+		return false
+	}
+	for _, value := range fields {
+		var n json.Number
+		if err := json.Unmarshal(value, &n); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// parseUnixMap reads a Unix time map, ordered by path.
+func parseUnixMap(data []byte) ([]FileModTime, error) {
+	var m map[string]int64
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	files := make([]FileModTime, 0, len(m))
+	for path, unixTime := range m {
+		files = append(files, FileModTime{Path: path, LastModified: time.Unix(unixTime, 0), UnixTime: unixTime})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// previewFileTimes writes "path: old -> new" to w for every file whose mtime
+// adjust or restore would change, without changing anything. Files already
+// at their time, missing files and, with KeepNewer, newer files are left
+// out.
+func (dh *DocHelper) previewFileTimes(w io.Writer, files []FileModTime) error {
+	const layout = "2006-01-02 15:04:05"
+
+	changes := 0
+	for _, file := range files {
+		info, err := os.Stat(filepath.Join(dh.TargetDir, file.Path))
+		if err != nil {
+			continue
+		}
+		current := info.ModTime()
+		if current.Unix() == file.LastModified.Unix() {
+			continue
+		}
+		if dh.KeepNewer && current.After(file.LastModified) {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s: %s -> %s\n", filepath.ToSlash(file.Path), current.Format(layout), file.LastModified.Format(layout))
+		changes++
+	}
+
+	slog.Info("Preview only, nothing changed", "would_change", changes, "unchanged", len(files)-changes)
+	return nil
+}
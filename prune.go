@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prune removes entries for files that no longer exist under TargetDir from
+// the document at Output and writes it back in place, in the same format
+// and JSON shape.
+// With PruneUntracked, entries for files git no longer tracks are removed
+// too. Paths are matched after stripping PathPrefix.
+func (dh *DocHelper) Prune() error {
+	if dh.Output == "" {
+		return fmt.Errorf("prune mode requires a document path")
+	}
+	path := dh.resolveOutput()
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrInputMissing, path)
+	}
+	if err == nil && info.IsDir() {
+		return fmt.Errorf("prune mode works on a single document, not a directory: %s", path)
+	}
+	if _, err := os.Stat(dh.TargetDir); os.IsNotExist(err) {
+		return withExitCode(exitTargetDir, fmt.Errorf("target directory does not exist: %s", dh.TargetDir))
+	}
+
+	var tracked map[string]bool
+	if dh.PruneUntracked {
+		if err := dh.checkRepo(); err != nil {
+			return err
+		}
+		paths, err := trackedFiles(dh.repo())
+		if err != nil {
+			return err
+		}
+		tracked = make(map[string]bool, len(paths))
+		for _, p := range paths {
+			tracked[p] = true
+		}
+	}
+
+	files, err := dh.loadDocument(path)
+	if err != nil {
+		return err
+	}
+
+	var kept []FileModTime
+	for _, file := range files {
+		rel := strings.TrimPrefix(file.Path, dh.PathPrefix)
+		if _, err := os.Lstat(filepath.Join(dh.TargetDir, filepath.FromSlash(rel))); os.IsNotExist(err) {
+			slog.Info("Pruned file that no longer exists", "path", file.Path)
+			continue
+		}
+		if tracked != nil && !file.IsDir && !tracked[rel] {
+			slog.Info("Pruned file not tracked by git", "path", file.Path)
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	removed := len(files) - len(kept)
+	if removed == 0 {
+		slog.Info("Nothing to prune", "path", path)
+		return nil
+	}
+
+	format := readableFormat(documentExt(path))
+	if format == nil {
+		sniffed, err := sniffFormat(path)
+		if err != nil {
+			return fmt.Errorf("cannot read file: %v", err)
+		}
+		format = readableFormat(sniffed)
+	}
+	if format.name == "json" {
+		if format, err = dh.jsonShapeOf(path); err != nil {
+			return err
+		}
+	}
+	if err := format.generate(dh, kept, path); err != nil {
+		return err
+	}
+
+	slog.Info("Pruned document", "path", path, "removed", removed, "kept", len(kept))
+	return nil
+}
+
+// jsonShapeOf returns the format to rewrite the JSON document at path with,
+// setting JSONShape to match its layout. A unixmap document keeps the
+// unixmap format, and the commit in a document's metadata is carried over
+// so a later --update still works on the pruned file.
+func (dh *DocHelper) jsonShapeOf(path string) (*documentFormat, error) {
+	data, err := readDocument(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file: %v", err)
+	}
+	switch {
+	case isUnixMap(data):
+		return formatByName("unixmap"), nil
+	case isPathMap(data):
+		dh.JSONShape = "map"
+		return formatByName("json"), nil
+	}
+	_, metadata, err := dh.parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	dh.JSONShape = "array"
+	if metadata != nil {
+		dh.commit = metadata.Commit
+	}
+	return formatByName("json"), nil
+}
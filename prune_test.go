@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md", "c.md")
+	gitCmd(t, dir, "rm", "-q", "--cached", "c.md")
+	if err := os.Remove(filepath.Join(dir, "b.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Unix(1700000000, 0)
+	files := []FileModTime{
+		{Path: "a.md", LastModified: at, UnixTime: at.Unix()},
+		{Path: "b.md", LastModified: at, UnixTime: at.Unix()},
+		{Path: "c.md", LastModified: at, UnixTime: at.Unix()},
+	}
+	output := filepath.Join(t.TempDir(), "times.csv")
+	dh := NewDocHelper(dir, output, "prune")
+	if err := dh.generateCSVDocument(files, output); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dh.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	assertPaths(t, dh, output, "a.md", "c.md")
+
+	dh.PruneUntracked = true
+	if err := dh.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	assertPaths(t, dh, output, "a.md")
+}
+
+func assertPaths(t *testing.T, dh *DocHelper, path string, want ...string) {
+	t.Helper()
+	files, err := dh.ReadFromCSV(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, file := range files {
+		got = append(got, file.Path)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPruneKeepsJSONShape(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+
+	at := time.Unix(1700000000, 0)
+	files := []FileModTime{
+		{Path: "a.md", LastModified: at, UnixTime: at.Unix()},
+		{Path: "gone.md", LastModified: at, UnixTime: at.Unix()},
+	}
+	for _, shape := range []string{"array", "map", "unixmap"} {
+		t.Run(shape, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "times.json")
+			dh := NewDocHelper(dir, output, "document")
+			dh.commit = "abc123"
+			var err error
+			if shape == "unixmap" {
+				err = dh.generateUnixMapDocument(files, output)
+			} else {
+				dh.JSONShape = shape
+				err = dh.generateJSONDocument(files, output)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := NewDocHelper(dir, output, "prune").Prune(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := isPathMap(data); got != (shape == "map") {
+				t.Errorf("path map = %v after prune:\n%s", got, data)
+			}
+			if got := isUnixMap(data); got != (shape == "unixmap") {
+				t.Errorf("unix map = %v after prune:\n%s", got, data)
+			}
+			pruned, metadata, err := dh.parseJSON(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pruned) != 1 || pruned[0].Path != "a.md" {
+				t.Errorf("kept %v, want only a.md", pruned)
+			}
+			if shape == "array" && (metadata == nil || metadata.Commit != "abc123") {
+				t.Errorf("metadata %+v lost the commit", metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// adjustState records the paths an adjust or restore has finished, one
+// slash-separated path per line, so an interrupted run can resume where it
+// stopped. Each path is written as soon as it is done.
+type adjustState struct {
+	path string
+	done map[string]bool
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// loadAdjustState reads the paths already listed in path, if it exists.
+// The file is only opened for appending by begin.
+func loadAdjustState(path string) (*adjustState, error) {
+	s := &adjustState{path: path, done: make(map[string]bool)}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				s.done[line] = true
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("cannot read state file: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot read state file: %v", err)
+	}
+	return s, nil
+}
+
+// begin opens the state file for appending, creating it if needed.
+func (s *adjustState) begin() error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot open state file: %v", err)
+	}
+	s.f = f
+	return nil
+}
+
+// close closes the state file if it is open. It is safe to call more than
+// once.
+func (s *adjustState) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+}
+
+// pending returns the files not yet finished by an earlier run.
+func (s *adjustState) pending(files []FileModTime) []FileModTime {
+	if len(s.done) == 0 {
+		return files
+	}
+	var rest []FileModTime
+	for _, file := range files {
+		if !s.done[filepath.ToSlash(file.Path)] {
+			rest = append(rest, file)
+		}
+	}
+	slog.Info("Resuming from state file", "path", s.path, "already_done", len(files)-len(rest), "remaining", len(rest))
+	return rest
+}
+
+// markDone appends rel to the state file.
+func (s *adjustState) markDone(rel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := fmt.Fprintln(s.f, filepath.ToSlash(rel)); err != nil {
+		slog.Warn("cannot update state file", "path", s.path, "error", err)
+	}
+}
+
+// finish closes the state file and, when the run completed without
+// failures, removes it so a later run starts afresh.
+func (s *adjustState) finish(complete bool) {
+	s.close()
+	if !complete {
+		slog.Info("Kept state file to resume from", "path", s.path)
+		return
+	}
+	if err := os.Remove(s.path); err != nil {
+		slog.Warn("cannot remove state file", "path", s.path, "error", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResumeFromState(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "docs/b.md")
+	state := filepath.Join(t.TempDir(), "restore.state")
+	// An earlier run finished a.md before being interrupted.
+	if err := os.WriteFile(state, []byte("a.md\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dh := newTestHelper(dir, nil)
+	dh.StatePath = state
+	dh.progress = &adjustProgress{}
+	if err := dh.AdjustFileTimes(sampleFiles()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := dh.progress.adjusted.Load(); n != 1 {
+		t.Errorf("adjusted %d files, want only the remaining one", n)
+	}
+	info, err := os.Stat(filepath.Join(dir, "a.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Equal(sampleFiles()[0].LastModified) {
+		t.Error("a.md was adjusted again although the state file lists it")
+	}
+	if _, err := os.Stat(state); !os.IsNotExist(err) {
+		t.Errorf("state file kept after a complete run: %v", err)
+	}
+
+	// A failed file keeps the state file, listing only what succeeded.
+	files := append(sampleFiles(), FileModTime{Path: filepath.Join("a.md", "child.md"), LastModified: time.Unix(1700000000, 0)})
+	dh.AdjustFileTimes(files)
+	data, err := os.ReadFile(state)
+	if err != nil {
+		t.Fatalf("state file removed after a failure: %v", err)
+	}
+	if string(data) != "a.md\ndocs/b.md\n" {
+		t.Errorf("state file = %q, want both finished paths", data)
+	}
+}
+
+func TestStateNotCreatedWithoutChanges(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "docs/b.md")
+
+	for _, tt := range []struct {
+		name string
+		set  func(dh *DocHelper)
+	}{
+		{"preview", func(dh *DocHelper) { dh.Preview = true }},
+		// Without a terminal and --yes, --confirm declines.
+		{"declined confirm", func(dh *DocHelper) { dh.Confirm = true }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			state := filepath.Join(t.TempDir(), "restore.state")
+			dh := newTestHelper(dir, nil)
+			dh.StatePath = state
+			tt.set(dh)
+			dh.AdjustFileTimes(sampleFiles())
+
+			if _, err := os.Stat(state); !os.IsNotExist(err) {
+				t.Errorf("state file exists after a run that changed nothing: %v", err)
+			}
+		})
+	}
+}
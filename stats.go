@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// extensionCount is the number of files sharing an extension.
+type extensionCount struct {
+	ext   string
+	count int
+}
+
+// countByExtension groups files by lower-cased extension, most common
+// first. Files without an extension are counted under "(none)".
+func countByExtension(files []FileModTime) []extensionCount {
+	counts := make(map[string]int)
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Path))
+		if ext == "" {
+			ext = "(none)"
+		}
+		counts[ext]++
+	}
+
+	var result []extensionCount
+	for ext, count := range counts {
+		result = append(result, extensionCount{ext, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].ext < result[j].ext
+	})
+	return result
+}
+
+// printStats logs the file count, the oldest and newest file and a
+// per-extension breakdown, for --count-only.
+func printStats(files []FileModTime) {
+	slog.Info("Files with git history", "count", len(files))
+	if len(files) == 0 {
+		return
+	}
+
+	oldest, newest := files[0], files[0]
+	for _, file := range files[1:] {
+		if file.LastModified.Before(oldest.LastModified) {
+			oldest = file
+		}
+		if file.LastModified.After(newest.LastModified) {
+			newest = file
+		}
+	}
+	slog.Info("Oldest", "path", oldest.Path, timeAttr(oldest.LastModified))
+	slog.Info("Newest", "path", newest.Path, timeAttr(newest.LastModified))
+
+	for _, c := range countByExtension(files) {
+		slog.Info("Extension", "ext", c.ext, "count", c.count)
+	}
+}
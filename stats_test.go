@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCountByExtension(t *testing.T) {
+	files := []FileModTime{{Path: "a.md"}, {Path: "b.MD"}, {Path: "c.go"}, {Path: "Makefile"}, {Path: "d.go"}, {Path: "e.md"}}
+	got := countByExtension(files)
+	want := []extensionCount{{".md", 3}, {".go", 2}, {"(none)", 1}}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCountOnlyWritesNothing(t *testing.T) {
+	dir := initGitRepo(t)
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+
+	output := filepath.Join(t.TempDir(), "times.json")
+	dh := NewDocHelper(dir, output, "document")
+	dh.CountOnly = true
+	if err := dh.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("--count-only wrote %s", output)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseGitmodules returns the path of every submodule section in the
+// contents of a .gitmodules file, as written relative to the repository
+// root.
+func parseGitmodules(data string) []string {
+	var paths []string
+	inSubmodule := false
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inSubmodule = strings.HasPrefix(line, "[submodule")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if inSubmodule && ok && strings.EqualFold(strings.TrimSpace(key), "path") {
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+			paths = append(paths, strings.Trim(value, "/"))
+		}
+	}
+	return paths
+}
+
+// submodulePaths reads .gitmodules at the repository root and returns the
+// set of submodule directories below TargetDir, as slash-separated paths
+// relative to it. A repository without .gitmodules has none.
+func (dh *DocHelper) submodulePaths() (map[string]bool, error) {
+	repo := dh.repo()
+	root := repo.WorkTree
+	if repo.Prefix != "" {
+		for range strings.Split(repo.Prefix, "/") {
+			root = filepath.Dir(root)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, ".gitmodules"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read .gitmodules: %v", err)
+	}
+
+	submodules := make(map[string]bool)
+	for _, name := range parseGitmodules(string(data)) {
+		if rel, ok := repo.relative(name); ok && rel != "" {
+			submodules[rel] = true
+		}
+	}
+	slog.Debug("Read .gitmodules", "submodules", len(submodules))
+	return submodules, nil
+}
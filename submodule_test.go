@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseGitmodules(t *testing.T) {
+	data := `[submodule "theme"]
+	path = themes/hugo
+	url = https://example.com/theme.git
+# a comment
+[core]
+	path = not-a-submodule
+[submodule "vendor"]
+	Path = "vendor/lib/"
+`
+	got := parseGitmodules(data)
+	if want := []string{"themes/hugo", "vendor/lib"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGitmodules = %v, want %v", got, want)
+	}
+}
+
+func TestSkipSubmodules(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, "a.md", "themes/hugo/layout.html", "themes/own.css")
+	gitmodules := "[submodule \"theme\"]\n\tpath = themes/hugo\n"
+	if err := os.WriteFile(filepath.Join(dir, ".gitmodules"), []byte(gitmodules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Unix(1700000000, 0)
+	dh := newTestHelper(dir, fakeGit{"a.md": at, "themes/hugo/layout.html": at, "themes/own.css": at, ".gitmodules": at})
+	dh.SkipSubmodules = true
+
+	files, err := dh.ScanDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		if filepath.ToSlash(file.Path) == "themes/hugo/layout.html" {
+			t.Errorf("submodule file %s was scanned", file.Path)
+		}
+	}
+	if len(files) != 3 {
+		t.Errorf("got %d files, want 3: %+v", len(files), files)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteTable writes files to w as a plain-text table with aligned columns,
+// for reading in a terminal.
+func (dh *DocHelper) WriteTable(w io.Writer, files []FileModTime) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if dh.RelativeTime {
+		fmt.Fprintln(tw, "PATH\tLAST MODIFIED\tAGE\tUNIX TIME")
+	} else {
+		fmt.Fprintln(tw, "PATH\tLAST MODIFIED\tUNIX TIME")
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		path := file.Path
+		if file.IsDir {
+			path += "/"
+		}
+		path = truncatePath(path, dh.MaxWidth)
+
+		if dh.RelativeTime {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", path, file.LastModified.Format("2006-01-02 15:04:05"), humanizeAge(now.Sub(file.LastModified)), file.UnixTime)
+		} else {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", path, file.LastModified.Format("2006-01-02 15:04:05"), file.UnixTime)
+		}
+	}
+	return tw.Flush()
+}
+
+// truncatePath shortens path to at most width characters by replacing its
+// start with an ellipsis, keeping the file name visible. A width of zero
+// or less leaves path unchanged.
+func truncatePath(path string, width int) string {
+	runes := []rune(path)
+	if width <= 0 || len(runes) <= width {
+		return path
+	}
+	if width == 1 {
+		return "…"
+	}
+	return "…" + string(runes[len(runes)-width+1:])
+}
+
+func (dh *DocHelper) generateTableDocument(files []FileModTime, outputPath string) error {
+	var buf bytes.Buffer
+	if err := dh.WriteTable(&buf, files); err != nil {
+		return err
+	}
+
+	err := dh.writeDocument(outputPath, buf.Bytes())
+	if err != nil {
+		return withExitCode(exitOutputFile, fmt.Errorf("cannot write file: %v", err))
+	}
+
+	slog.Info("Generated table document", "path", outputPath, "files", len(files))
+	return nil
+}
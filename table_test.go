@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWriteTable(t *testing.T) {
+	at := time.Date(2024, time.January, 15, 10, 30, 0, 0, time.Local)
+	files := []FileModTime{
+		{Path: "a.md", LastModified: at, UnixTime: at.Unix()},
+		{Path: "docs/guides/very-long-name.md", LastModified: at, UnixTime: at.Unix()},
+	}
+
+	dh := NewDocHelper(t.TempDir(), "", "document")
+	dh.MaxWidth = 12
+	var buf bytes.Buffer
+	if err := dh.WriteTable(&buf, files); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "PATH") {
+		t.Errorf("header = %q", lines[0])
+	}
+	column := utf8.RuneCountInString(lines[0][:strings.Index(lines[0], "LAST MODIFIED")])
+	for _, line := range lines[1:] {
+		if utf8.RuneCountInString(line[:strings.Index(line, "2024-01-15")]) != column {
+			t.Errorf("line %q is not aligned with the header", line)
+		}
+	}
+	if !strings.HasPrefix(lines[2], "…ong-name.md ") {
+		t.Errorf("long path not truncated: %q", lines[2])
+	}
+}
+
+func TestFormatOverridesExtension(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "times.json")
+	dh := NewDocHelper(dir, "", "document")
+	dh.Format = "table"
+	if err := dh.generateFile(sampleFiles(), output); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "PATH") {
+		t.Errorf("output = %q, want a table", data)
+	}
+}
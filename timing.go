@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Phases measured by --timing.
+const (
+	phaseScan   = iota
+	phaseGit    // git work outside single lookups, such as batch prefetch
+	phaseLookup // one git lookup, counted as git time
+	phaseWrite
+)
+
+// phaseTimes accumulates the time spent in each phase of a run for
+// --timing. Git lookups are counted inside the scan as well as on their
+// own, and may overlap when they run concurrently.
+type phaseTimes struct {
+	scan, git, write atomic.Int64
+	lookups          atomic.Int64
+}
+
+// track adds the time since start to phase. A nil phaseTimes ignores it,
+// so callers can defer it unconditionally.
+func (p *phaseTimes) track(phase int, start time.Time) {
+	if p == nil {
+		return
+	}
+	elapsed := int64(time.Since(start))
+	switch phase {
+	case phaseScan:
+		p.scan.Add(elapsed)
+	case phaseGit:
+		p.git.Add(elapsed)
+	case phaseLookup:
+		p.git.Add(elapsed)
+		p.lookups.Add(1)
+	case phaseWrite:
+		p.write.Add(elapsed)
+	}
+}
+
+// log prints the accumulated times.
+func (p *phaseTimes) log() {
+	round := func(v *atomic.Int64) time.Duration { return time.Duration(v.Load()).Round(time.Millisecond) }
+	slog.Info("Timing", "scan", round(&p.scan), "git", round(&p.git), "git_lookups", p.lookups.Load(), "write", round(&p.write))
+}
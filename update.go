@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadForUpdate reads the existing output document for --update and limits
+// the next scan to files changed since the commit the document records. It
+// returns the entries to carry over unchanged, or nil when the document is
+// missing or records no usable commit and a full scan is needed.
+func (dh *DocHelper) loadForUpdate() ([]FileModTime, error) {
+	path := dh.resolveOutput()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		slog.Info("No existing document, running a full scan", "path", path)
+		return nil, nil
+	}
+	if documentExt(path) != ".json" {
+		return nil, fmt.Errorf("%w: --update requires a JSON document, which records the commit it was generated at", ErrUnsupportedFormat)
+	}
+
+	files, metadata, err := dh.ReadFromJSON(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read file: %v", err)
+	}
+	if metadata == nil || metadata.Commit == "" {
+		slog.Warn("document does not record a commit, running a full scan", "path", path)
+		return nil, nil
+	}
+
+	changed, err := changedFiles(dh.repo(), metadata.Commit)
+	if err != nil {
+		slog.Warn("cannot compare with the recorded commit, running a full scan", "commit", metadata.Commit, "error", err)
+		return nil, nil
+	}
+
+	var kept []FileModTime
+	for _, file := range files {
+		// Directory and missing-file entries are recomputed after the scan.
+		if file.IsDir || file.Missing {
+			continue
+		}
+		rel := strings.TrimPrefix(file.Path, dh.PathPrefix)
+		if changed[rel] {
+			continue
+		}
+		file.Path = filepath.FromSlash(rel)
+		kept = append(kept, file)
+	}
+
+	dh.ChangedSince = metadata.Commit
+	slog.Info("Updating document", "path", path, "since", metadata.Commit, "kept", len(kept), "changed", len(changed))
+	return kept, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUpdate(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md", "gone.md")
+
+	output := filepath.Join(t.TempDir(), "times.json")
+	if err := NewDocHelper(dir, output, "document").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "b.md", "new.md")
+	gitCmd(t, dir, "rm", "-q", "gone.md")
+	gitCmd(t, dir, "commit", "-q", "-m", "remove")
+
+	dh := NewDocHelper(dir, output, "document")
+	dh.Update = true
+	if err := dh.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, metadata, err := dh.ReadFromJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Commit != dh.commit || metadata.Commit == "" {
+		t.Errorf("recorded commit %q, want HEAD %q", metadata.Commit, dh.commit)
+	}
+
+	got := make(map[string]time.Time)
+	for _, file := range files {
+		got[file.Path] = file.LastModified
+	}
+	want := map[string]time.Time{
+		"a.md":   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"b.md":   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		"new.md": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for path, at := range want {
+		if !got[path].Equal(at) {
+			t.Errorf("%s: got %s, want %s", path, got[path], at)
+		}
+	}
+}
+
+func TestUpdateRename(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "docs/b.md", "c.md")
+
+	output := filepath.Join(t.TempDir(), "times.json")
+	if err := NewDocHelper(dir, output, "document").Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rename and a move to another directory, both with unchanged content.
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	gitCmd(t, dir, "mv", "a.md", "renamed.md")
+	gitCmd(t, dir, "mv", "docs", "moved")
+	gitCmd(t, dir, "commit", "-q", "-m", "rename")
+
+	dh := NewDocHelper(dir, output, "document")
+	dh.Update = true
+	if err := dh.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _, err := dh.ReadFromJSON(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]time.Time)
+	for _, file := range files {
+		got[file.Path] = file.LastModified
+	}
+	want := map[string]time.Time{
+		"c.md":       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"renamed.md": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		"moved/b.md": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v without the old paths", got, want)
+	}
+	for path, at := range want {
+		if !got[path].Equal(at) {
+			t.Errorf("%s: got %s, want %s", path, got[path], at)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long watch mode waits for events to settle before
+// re-stamping the affected files. Tests shorten it.
+var watchDebounce = 500 * time.Millisecond
+
+// Watch keeps running until ctx is cancelled, re-stamping files with their
+// git time when they are written or created, and re-stamping the files of
+// every new commit when HEAD or the branch it points to moves.
+func (dh *DocHelper) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot start file watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	if err := dh.watchTree(watcher, dh.TargetDir); err != nil {
+		return err
+	}
+
+	gitDir, err := dh.gitDirPath()
+	if err != nil {
+		return fmt.Errorf("cannot locate git directory: %v", err)
+	}
+	// HEAD lives in the git directory; branches and packed-refs live in the
+	// common directory, which differs from it in a linked worktree.
+	gitDirs := []string{gitDir}
+	if common := dh.gitCommonDir(); common != "" && common != gitDir {
+		gitDirs = append(gitDirs, common)
+	}
+	for _, dir := range gitDirs {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("cannot watch %s: %v", dir, err)
+		}
+	}
+	refsDir := filepath.Join(gitDirs[len(gitDirs)-1], "refs", "heads")
+	if err := dh.watchTree(watcher, refsDir); err != nil {
+		return err
+	}
+	inGitDir := func(path string) bool {
+		for _, dir := range gitDirs {
+			if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	head, _ := runGit(dh.repo(), "rev-parse", "HEAD")
+	head = strings.TrimSpace(head)
+
+	pending := make(map[string]bool)
+	headMayHaveMoved := false
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	slog.Info("Watching for changes (press Ctrl+C to stop)", "path", dh.TargetDir)
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped watching")
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if inGitDir(event.Name) {
+				// Branch names with a slash create directories below refs/heads.
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && strings.HasPrefix(event.Name, refsDir+string(filepath.Separator)) {
+					if err := dh.watchTree(watcher, event.Name); err != nil {
+						slog.Warn(err.Error())
+					}
+				}
+				headMayHaveMoved = true
+				timer.Reset(watchDebounce)
+				continue
+			}
+
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				if err := dh.watchTree(watcher, event.Name); err != nil {
+					slog.Warn(err.Error())
+				}
+				continue
+			}
+
+			pending[event.Name] = true
+			timer.Reset(watchDebounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("watcher error", "error", err)
+
+		case <-timer.C:
+			if headMayHaveMoved {
+				headMayHaveMoved = false
+				head = dh.collectCommitted(head, pending)
+			}
+
+			for path := range pending {
+				dh.restamp(path)
+				delete(pending, path)
+			}
+		}
+	}
+}
+
+// watchTree adds root and every directory below it to watcher, skipping .git.
+func (dh *DocHelper) watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("cannot watch %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// gitCommonDir returns the absolute directory holding the repository's refs,
+// or "" when git cannot tell.
+func (dh *DocHelper) gitCommonDir() string {
+	output, err := runGit(dh.repo(), "rev-parse", "--git-common-dir")
+	if err != nil {
+		return ""
+	}
+	dir := strings.TrimSpace(output)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(dh.TargetDir, dir)
+	}
+	return filepath.Clean(dir)
+}
+
+// collectCommitted adds the files changed between head and the current HEAD
+// to pending and returns the current HEAD.
+func (dh *DocHelper) collectCommitted(head string, pending map[string]bool) string {
+	current, err := runGit(dh.repo(), "rev-parse", "HEAD")
+	if err != nil {
+		return head
+	}
+	current = strings.TrimSpace(current)
+	if current == head || head == "" {
+		return current
+	}
+
+	changed, err := changedFiles(dh.repo(), head)
+	if err != nil {
+		slog.Warn(err.Error())
+		return current
+	}
+	for rel := range changed {
+		pending[filepath.Join(dh.TargetDir, filepath.FromSlash(rel))] = true
+	}
+	return current
+}
+
+// restamp sets the mtime of path to its git last-modified time.
+func (dh *DocHelper) restamp(path string) {
+	relPath, _ := filepath.Rel(dh.TargetDir, path)
+
+	lastModified, _, err := dh.GetGitLastModified(path)
+	if err != nil {
+		slog.Error("cannot get git modified time", "path", relPath, "error", err)
+		return
+	}
+	if lastModified.IsZero() {
+		return
+	}
+
+	if err := dh.chtimes(path, lastModified); err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("cannot adjust time", "path", relPath, "error", err)
+		}
+		return
+	}
+	slog.Info("Adjusted", "path", relPath, timeAttr(lastModified))
+}
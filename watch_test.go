@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForMtime polls until path has mtime want, calling poke before each
+// check, and fails the test after a few seconds.
+func waitForMtime(t *testing.T, path string, want time.Time, poke func()) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		poke()
+		time.Sleep(50 * time.Millisecond)
+		if info, err := os.Stat(path); err == nil && info.ModTime().Equal(want) {
+			return
+		}
+	}
+	info, _ := os.Stat(path)
+	t.Fatalf("%s: mtime %v, want %v", path, info.ModTime(), want)
+}
+
+func TestWatch(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md", "b.md")
+	first := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "b.md")
+	second := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	branch := strings.TrimSpace(gitCmd(t, dir, "symbolic-ref", "HEAD"))
+	// Move the branch back; b.md keeps the second commit's content.
+	gitCmd(t, dir, "update-ref", branch, first)
+
+	saved := watchDebounce
+	watchDebounce = 20 * time.Millisecond
+	defer func() { watchDebounce = saved }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- NewDocHelper(dir, "", "watch").Watch(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	// A written file is re-stamped with its git time once events settle.
+	a := filepath.Join(dir, "a.md")
+	waitForMtime(t, a, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), func() {
+		if err := os.WriteFile(a, []byte("edited"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Moving the current branch without touching HEAD, as tools that write
+	// refs directly do, re-stamps the files of the new commit.
+	b := filepath.Join(dir, "b.md")
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(b, old, old); err != nil {
+		t.Fatal(err)
+	}
+	ref := filepath.Join(dir, ".git", filepath.FromSlash(branch))
+	if err := os.WriteFile(ref, []byte(second+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForMtime(t, b, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), func() {})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Extended attributes written by xattr mode.
+const (
+	xattrTime   = "user.dochelper.gittime"
+	xattrCommit = "user.dochelper.commit"
+)
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// WriteXattrs stores each file's git time, as RFC3339, and the hash of the
+// commit the scan took it from in extended attributes, leaving mtimes
+// alone.
+// The attributes survive tools that later rewrite mtimes.
+func (dh *DocHelper) WriteXattrs(files []FileModTime) error {
+	defer dh.timing.track(phaseWrite, time.Now())
+	written := 0
+	var failures errorList
+	for _, file := range files {
+		fullPath := filepath.Join(dh.TargetDir, file.Path)
+
+		err := setXattr(fullPath, xattrTime, []byte(file.LastModified.Format(time.RFC3339)))
+		if err == nil && file.commit != "" {
+			err = setXattr(fullPath, xattrCommit, []byte(file.commit))
+		}
+		if errors.Is(err, errXattrUnsupported) {
+			return err
+		}
+		if err != nil {
+			slog.Error("cannot write extended attributes", "path", file.Path, "error", err)
+			failures.add(file, err)
+			continue
+		}
+		slog.Info("Stored", "path", file.Path, timeAttr(file.LastModified), "commit", file.commit)
+		written++
+	}
+
+	failed := len(files) - written
+	slog.Info("Completed", "stored", written, "failed", failed)
+	if err := failures.fileErrors(fmt.Sprintf("failed to store extended attributes for %d of %d files", failed, len(files))); err != nil {
+		return withExitCode(exitPartial, err)
+	}
+	return nil
+}
+
+// ReadXattrs returns the git time and commit stored on path by xattr mode.
+// The commit is empty when it was not recorded. On platforms without
+// extended attributes it returns errXattrUnsupported.
+func ReadXattrs(path string) (time.Time, string, error) {
+	value, err := getXattr(path, xattrTime)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(string(value)))
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid %s: %v", xattrTime, err)
+	}
+
+	commit, err := getXattr(path, xattrCommit)
+	if err != nil {
+		commit = nil
+	}
+	return t, string(commit), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package main
+
+func setXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package main
+
+import "golang.org/x/sys/unix"
+
+func setXattr(path, name string, value []byte) error {
+	return unix.Setxattr(path, name, value, 0)
+}
+
+func getXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Getxattr(path, name, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteXattrs(t *testing.T) {
+	dir := initGitRepo(t)
+	t.Setenv("GIT_COMMITTER_DATE", "2024-01-01T00:00:00Z")
+	commitFiles(t, dir, "2024-01-01T00:00:00Z", "a.md")
+	tagged := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	gitCmd(t, dir, "tag", "v1")
+	t.Setenv("GIT_COMMITTER_DATE", "2024-02-01T00:00:00Z")
+	commitFiles(t, dir, "2024-02-01T00:00:00Z", "a.md")
+
+	path := filepath.Join(dir, "a.md")
+	if err := setXattr(path, xattrTime, []byte("probe")); err != nil {
+		t.Skipf("extended attributes not usable here: %v", err)
+	}
+
+	// The stored commit is the one the scanned time came from, here the
+	// tagged commit rather than the newest one.
+	dh := NewDocHelper(dir, "", "xattr")
+	dh.TaggedOnly = true
+	if err := dh.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, commit, err := ReadXattrs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !got.Equal(at) || commit != tagged {
+		t.Errorf("got %s %q, want %s %q", got, commit, at, tagged)
+	}
+}